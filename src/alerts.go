@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type alertKind string
+
+const (
+	ALERT_ABOVE  alertKind = "above"  // last trade at or above value
+	ALERT_BELOW  alertKind = "below"  // last trade at or below value
+	ALERT_MOVE   alertKind = "move"   // absolute change % at or above value
+	ALERT_HIGH52 alertKind = "high52" // last trade reaches the 52-week high
+	ALERT_VOLUME alertKind = "volume" // volume at or above value x avg volume
+	ALERT_EXPR   alertKind = "when"   // expression such as "rsi(14) < 30" holds
+)
+
+// how far a value has to fall back behind the threshold before a triggered
+// alert is re-armed, so that it doesn't fire again on every refresh
+const (
+	priceHysteresis = 0.01 // fraction of the price threshold
+	ratioHysteresis = 0.2  // fraction of the percent/volume threshold
+)
+
+// alertRule is a single alert on a ticker, persisted in the profile
+type alertRule struct {
+	Ticker    string
+	Kind      alertKind
+	Value     float64
+	Expr      string         `json:",omitempty"` // condition of a "when" alert
+	Channels  []alertChannel // where to deliver the alert besides the terminal
+	Triggered bool           // condition hit and not yet re-armed
+	Acked     bool           // user has acknowledged the triggered alert
+	LastFired time.Time      // time the alert last fired
+}
+
+// firedAlert is a rule that fired along with the quote that fired it
+type firedAlert struct {
+	rule  alertRule
+	quote Quote
+}
+
+func (rule alertRule) String() string {
+	s := fmt.Sprintf("%s %s", rule.Ticker, rule.Kind)
+	switch rule.Kind {
+	case ALERT_HIGH52:
+	case ALERT_EXPR:
+		s += " " + rule.Expr
+	default:
+		s += " " + strconv.FormatFloat(rule.Value, 'f', -1, 64)
+	}
+	if len(rule.Channels) > 0 {
+		channels := make([]string, len(rule.Channels))
+		for id, channel := range rule.Channels {
+			channels[id] = string(channel)
+		}
+		s += " via " + strings.Join(channels, ",")
+	}
+	return s
+}
+
+// parseAlertRule parses a rule such as "AAPL above 150", "TSLA high52" or
+// "MSFT when rsi(14) < 30", optionally followed by the channels to deliver
+// it to, e.g. "via exec,notify"
+func parseAlertRule(s string) (alertRule, error) {
+	rule := alertRule{}
+	fields := strings.Fields(s)
+	for id, field := range fields {
+		if strings.ToLower(field) != "via" {
+			continue
+		}
+		if id != len(fields)-2 {
+			return rule, fmt.Errorf("usage: via exec|webhook|notify[,...]")
+		}
+		channels, err := parseAlertChannels(fields[id+1])
+		if err != nil {
+			return rule, err
+		}
+		rule.Channels = channels
+		fields = fields[:id]
+		break
+	}
+
+	if len(fields) < 2 {
+		return rule, fmt.Errorf("usage: <ticker> above|below|move|high52|volume|when [value] [via channels]")
+	}
+
+	rule.Ticker = strings.ToUpper(fields[0])
+	rule.Kind = alertKind(strings.ToLower(fields[1]))
+
+	switch rule.Kind {
+	case ALERT_HIGH52:
+		if len(fields) != 2 {
+			return rule, fmt.Errorf("high52 takes no value")
+		}
+		return rule, nil
+	case ALERT_ABOVE, ALERT_BELOW, ALERT_MOVE, ALERT_VOLUME:
+		if len(fields) != 3 {
+			return rule, fmt.Errorf("%s needs a value", rule.Kind)
+		}
+		value, err := strconv.ParseFloat(strings.TrimSuffix(fields[2], "%"), 64)
+		if err != nil || value <= 0 {
+			return rule, fmt.Errorf("invalid value '%s'", fields[2])
+		}
+		rule.Value = value
+		return rule, nil
+	case ALERT_EXPR:
+		if len(fields) < 3 {
+			return rule, fmt.Errorf("when needs a condition")
+		}
+		rule.Expr = strings.Join(fields[2:], " ")
+		if _, err := parseExpr(rule.Expr); err != nil {
+			return rule, err
+		}
+		return rule, nil
+	}
+	return rule, fmt.Errorf("unknown alert type '%s'", fields[1])
+}
+
+// check reports whether the rule's condition holds for q, and whether q has
+// moved far enough away from the threshold for the rule to be re-armed
+func (rule *alertRule) check(q Quote, indicators *indicatorCache) (active,
+	rearm bool) {
+
+	switch rule.Kind {
+	case ALERT_ABOVE:
+		return q.LastTrade >= rule.Value,
+			q.LastTrade < rule.Value*(1-priceHysteresis)
+	case ALERT_BELOW:
+		return q.LastTrade <= rule.Value,
+			q.LastTrade > rule.Value*(1+priceHysteresis)
+	case ALERT_MOVE:
+		move := math.Abs(q.ChangePct)
+		return move >= rule.Value, move < rule.Value*(1-ratioHysteresis)
+	case ALERT_HIGH52:
+		if q.High52 <= 0 {
+			return false, false
+		}
+		return q.LastTrade >= q.High52,
+			q.LastTrade < q.High52*(1-priceHysteresis)
+	case ALERT_VOLUME:
+		if q.AvgVolume <= 0 {
+			return false, false
+		}
+		ratio := q.Volume / q.AvgVolume
+		return ratio >= rule.Value, ratio < rule.Value*(1-ratioHysteresis)
+	case ALERT_EXPR:
+		expr, err := parseExpr(rule.Expr)
+		if err != nil {
+			return false, false
+		}
+		// a missing value, e.g. no history yet, neither fires nor re-arms
+		v := expr.eval(exprEnv{quote: q, indicators: indicators})
+		if math.IsNaN(v) {
+			return false, false
+		}
+		return truthy(v), !truthy(v)
+	}
+	return false, false
+}
+
+// evaluateAlerts updates the state of every rule against the latest quotes
+// and returns the rules that fired on this refresh
+func evaluateAlerts(rules []alertRule, quotes []Quote,
+	indicators *indicatorCache) []firedAlert {
+
+	byTicker := make(map[string]Quote, len(quotes))
+	for _, q := range quotes {
+		byTicker[strings.ToUpper(q.Ticker)] = q
+	}
+
+	fired := []firedAlert{}
+	for i := range rules {
+		rule := &rules[i]
+		q, ok := byTicker[rule.Ticker]
+		if !ok {
+			continue
+		}
+
+		active, rearm := rule.check(q, indicators)
+		if active && !rule.Triggered {
+			rule.Triggered = true
+			rule.Acked = false
+			rule.LastFired = time.Now()
+			fired = append(fired, firedAlert{rule: *rule, quote: q})
+		} else if rearm && rule.Triggered {
+			rule.Triggered = false
+			rule.Acked = false
+		}
+	}
+	return fired
+}
+
+// hasActiveAlert reports whether ticker has a triggered, unacknowledged alert
+func hasActiveAlert(rules []alertRule, ticker string) bool {
+	for _, rule := range rules {
+		if rule.Triggered && !rule.Acked &&
+			strings.EqualFold(rule.Ticker, ticker) {
+			return true
+		}
+	}
+	return false
+}
+
+// alertsUseIndicators reports whether any rule needs the daily history
+func alertsUseIndicators(rules []alertRule) bool {
+	for _, rule := range rules {
+		if rule.Kind != ALERT_EXPR {
+			continue
+		}
+		if expr, err := parseExpr(rule.Expr); err == nil && usesIndicators(expr) {
+			return true
+		}
+	}
+	return false
+}
+
+func ringBell() {
+	fmt.Print("\a")
+}
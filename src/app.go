@@ -25,33 +25,25 @@ const (
 	COMMAND
 	SORT
 	CONFIRM_QUIT // new mode for quit confirmation
+	ALERTS       // list of alert rules opened with :alerts
+	COLUMNS      // column chooser opened with :columns
+	CHART        // full screen chart of the selected ticker
+	COMPARE      // chart comparing several tickers opened with :compare
+	VISUAL       // range of rows selected with V for bulk operations
+	HELP         // key bindings and commands of the mode ? was pressed in
 )
 
-var navBindingKeys = map[termbox.Key]rune{
-	termbox.KeyArrowDown:  'j',
-	termbox.KeyArrowUp:    'k',
-	termbox.KeyArrowLeft:  'h',
-	termbox.KeyArrowRight: 'l',
-}
-
-var navKeys = map[rune]int{
-	'j': 6,
-	'k': 7,
-	'h': 0,
-	'l': 1,
-	'b': 2,
-	'e': 3,
-	'0': 4,
-	'$': 5,
-}
-
 type app struct {
 	ui       *Ui
 	ticker   *time.Ticker
-	quitChan chan bool
+	refresh  time.Duration // period of ticker
+	quitChan chan bool     // true to save the profile before quitting
 	keyQueue chan termbox.Event
 	profile  *profile
 	mode     *mode
+	keymap   *keymap
+	count    int     // count typed before the key of the running action
+	esc      escKeys // Esc on the command line waiting to be told from Alt
 
 	// debounce keypresses
 	allowOpenInBrowser bool
@@ -59,13 +51,50 @@ type app struct {
 }
 
 type portfolio struct {
-	Tickers []string // list of stock tickers to display
+	Tickers []string        // list of stock tickers to display
+	Columns []columnSetting // order, width and visibility of the columns
+	Sort    []sortKey       `json:",omitempty"` // empty for the order of Tickers
 }
 
 type profile struct {
 	Portfolios map[string]portfolio
 	filepath   string
 	Tickers    []string
+	Alerts     []alertRule
+	Notifiers  notifierConfig
+	Columns    []customColumn      // computed columns shown after the built-in ones
+	Tags       map[string][]string `json:",omitempty"` // ticker -> tags
+	Notes      map[string]string   `json:",omitempty"` // ticker -> note
+
+	// key bindings overriding the defaults, mode -> keys -> action
+	Keymap map[string]map[string]string `json:",omitempty"`
+
+	ChartOverlays []string // indicators drawn over price charts, e.g. "sma(20)"
+
+	// :set options other than the defaults, name -> value
+	Options map[string]string `json:",omitempty"`
+
+	current string          // name of the loaded portfolio, "" if unsaved
+	columns []columnSetting // column settings of the loaded portfolio
+	sort    []sortKey       // sort of the loaded portfolio, empty for manual order
+	filter  string          // only tickers for which this expression holds
+}
+
+// saveOrder stores the order of the tickers with the loaded portfolio
+func (profile *profile) saveOrder() {
+	if p, ok := profile.Portfolios[profile.current]; ok {
+		p.Tickers = append([]string{}, profile.Tickers...)
+		profile.Portfolios[profile.current] = p
+	}
+}
+
+// saveSettings stores the column and sort settings with the loaded portfolio
+func (profile *profile) saveSettings() {
+	if p, ok := profile.Portfolios[profile.current]; ok {
+		p.Columns = append([]columnSetting{}, profile.columns...)
+		p.Sort = append([]sortKey{}, profile.sort...)
+		profile.Portfolios[profile.current] = p
+	}
 }
 
 func (profile *profile) Save() error {
@@ -102,6 +131,12 @@ func loadProfile(user *user.User) (*profile, error) {
 	}
 	profile.Tickers = make([]string, len(profile.Portfolios["default"].Tickers))
 	copy(profile.Tickers, profile.Portfolios["default"].Tickers)
+	profile.current = "default"
+	profile.columns = append([]columnSetting{}, profile.Portfolios["default"].Columns...)
+	profile.sort = append([]sortKey{}, profile.Portfolios["default"].Sort...)
+	if profile.ChartOverlays == nil {
+		profile.ChartOverlays = defaultChartOverlays
+	}
 
 	return profile, nil
 }
@@ -158,126 +193,134 @@ func newApp() *app {
 		}
 	}()
 
-	return &app{
+	keymap, errs := newKeymap(newActions(), profile.Keymap)
+	ui.keymap = keymap
+	errs = append(errs, profile.checkOptions()...)
+	if len(errs) > 0 {
+		// the first problem is shown, the others once it is fixed
+		ui.lineEditor.PrintErrorf("%v", errs[0])
+	}
+
+	app := &app{
 		ui:                 ui,
+		keymap:             keymap,
 		quitChan:           quitChan,
-		ticker:             time.NewTicker(60 * time.Second),
 		keyQueue:           keyQueue,
 		profile:            profile,
 		mode:               &mode,
 		allowOpenInBrowser: true,
-		debounceDuration:   DEFAULT_DEBOUNCE_DURATION,
 	}
+	app.applyOptions()
+	return app
+}
 
+// applyOptions puts the :set options in effect
+func (app *app) applyOptions() {
+	if refresh := app.profile.durationOption("refresh"); refresh != app.refresh {
+		if app.ticker != nil {
+			app.ticker.Stop()
+		}
+		app.ticker = time.NewTicker(refresh)
+		app.refresh = refresh
+	}
+	app.debounceDuration = app.profile.durationOption("debounce")
+	app.ui.applyOptions()
 }
 
 // main app loop
 func (app *app) loop() {
-	app.fetchAndDraw()
+	// the startup commands load and draw the quotes themselves
+	if !app.ui.SourceStartup(path.Join(path.Dir(app.profile.filepath),
+		"monmoprc.cmds")) {
+		app.fetchAndDraw()
+	}
+	app.applyOptions()
 	defer file.Close()
 	for {
 		select {
-		case <-app.quitChan:
+		case save := <-app.quitChan:
 			// TODO: disable this until we can handle this better,
 			// i.e. with some kind of user prompt
-			app.saveProfile()
+			if save {
+				app.saveProfile()
+			}
 			return // exit app
 		case event := <-app.keyQueue:
 			switch event.Type {
 			case termbox.EventKey:
 				switch *app.mode {
 				case COMMAND:
+					event, ok := app.esc.Press(event)
+					if !ok {
+						// an Esc, unless a key follows it straight away
+						break
+					}
 					if event.Key == termbox.KeyEnter {
-						app.ui.ExecuteCommand()
-						// app.fetchAndDraw()
+						// commands may switch to another mode themselves
 						*app.mode = NORMAL
+						app.ui.ExecuteCommand()
+						app.applyOptions()
 					} else if event.Key == termbox.KeyEsc {
-						app.ui.lineEditor.Done()
-						*app.mode = NORMAL
-						app.ui.Draw()
+						app.cancelCommand()
+					} else if app.ui.lineEditor.AsksForHelp(event) {
+						app.ui.OpenHelp(COMMAND)
 					} else {
 						app.ui.HandleLineEditorInput(event)
 					}
-				case NORMAL:
-					if event.Ch == 'q' || event.Ch == 'Q' {
-						app.saveProfile()
-						return
-					} else if event.Ch == 'j' || event.Key == termbox.KeyArrowDown {
-						app.ui.navigateStockDown()
-						app.ui.Draw()
-					} else if event.Ch == 'k' || event.Key == termbox.KeyArrowUp {
-						app.ui.navigateStockUp()
-						app.ui.Draw()
-					} else if event.Ch == 'g' {
-						app.ui.navigateStockBeginning()
-						app.ui.Draw()
-					} else if event.Ch == 'G' {
-						app.ui.navigateStockEnd()
-						app.ui.Draw()
-					} else if event.Ch == 'r' {
-						// r for  "refresh"
-						app.fetchAndDraw()
-					} else if event.Ch == 's' {
-						// s for  "sort"
-						*app.mode = SORT
-						app.ui.Draw()
-					} else if event.Ch == 'a' {
-						// a for "add"
-						app.ui.Prompt(event.Ch)
-						*app.mode = COMMAND
-					} else if event.Ch == 'd' {
-						// a for "add"
-						app.ui.Prompt(event.Ch)
-						*app.mode = COMMAND
-					} else if event.Ch == ':' {
-						// a for "add"
-						app.ui.Prompt(event.Ch)
-						*app.mode = COMMAND
-					} else if event.Ch == '/' {
-						// a for "add"
-						app.ui.Prompt(event.Ch)
-						*app.mode = COMMAND
-					} else if event.Ch == 'o' || event.Key == termbox.KeyEnter {
-						// Check if OpenInBrowser action is allowed
-						if app.allowOpenInBrowser {
-							app.ui.OpenInBrowser()
-
-							// Debounce the action
-							app.allowOpenInBrowser = false
-							time.AfterFunc(app.debounceDuration, func() {
-								app.allowOpenInBrowser = true
-							})
-						}
-					}
-				case SORT:
-					if event.Ch == 'q' || event.Ch == 'Q' {
-						// app.saveProfile()
-						return
-					} else if isLabelNavigationEvent(event) {
-						if ch, ok := navBindingKeys[event.Key]; ok {
-							app.ui.HandleSortEvent(ch)
-						} else {
-							app.ui.HandleSortEvent(event.Ch)
-						}
-					} else if event.Key == termbox.KeyEsc {
-						*app.mode = NORMAL
+				case HELP:
+					if app.ui.help.searching {
+						app.ui.help.HandleSearch(event)
 						app.ui.Draw()
+					} else {
+						app.press(event)
 					}
+				default:
+					app.press(event)
 				}
 
+			case termbox.EventMouse:
+				if *app.mode == NORMAL || *app.mode == SORT {
+					app.ui.HandleMouse(event)
+				}
 			case termbox.EventResize:
 				app.ui.Resize()
 			}
+		case <-app.esc.timeout:
+			app.esc.timeout = nil
+			if *app.mode == COMMAND {
+				app.cancelCommand()
+			}
 		case <-app.ticker.C:
 			app.fetchAndDraw()
 		}
 	}
 }
-func isLabelNavigationEvent(e termbox.Event) bool {
-	if _, ok := navKeys[e.Ch]; ok {
-		return true
+
+// cancelCommand leaves the command line without running it
+func (app *app) cancelCommand() {
+	if app.ui.lineEditor.cmd == '/' {
+		app.ui.CancelSearch()
+	}
+	if app.ui.lineEditor.cmd == 'A' {
+		// editing a rule from the alerts view
+		*app.mode = ALERTS
+	} else {
+		*app.mode = NORMAL
 	}
-	return false
+	app.ui.stopVisual()
+	app.ui.lineEditor.Done()
+	app.ui.Draw()
+}
+
+// press runs the action of the keys typed so far, if they complete one
+func (app *app) press(event termbox.Event) {
+	act, count := app.keymap.Press(*app.mode, eventKey(event))
+	app.ui.pendingKeys = app.keymap.Pending()
+	if act != nil {
+		app.count = count
+		act.run(app)
+	}
+	app.ui.Draw()
 }
 
 func (app *app) fetchAndDraw() {
@@ -0,0 +1,563 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/nsf/termbox-go"
+)
+
+type chartStyle int
+
+const (
+	CHART_CANDLES chartStyle = iota
+	CHART_LINE
+)
+
+const (
+	chartAxisWidth = 10 // price labels on the right of the plot
+	brailleBase    = 0x2800
+)
+
+// ranges selectable with the number keys in the chart view
+var chartRanges = []struct {
+	label string
+	rng   string
+}{
+	{"1d", "1d"},
+	{"5d", "5d"},
+	{"1m", "1mo"},
+	{"3m", "3mo"},
+	{"6m", "6mo"},
+	{"1y", "1y"},
+	{"5y", "5y"},
+}
+
+// indicators drawn over the chart when the profile doesn't set any
+var defaultChartOverlays = []string{"sma(20)", "sma(50)"}
+
+// colors of the overlays, in order
+var overlayColors = []termbox.Attribute{
+	termbox.ColorYellow,
+	termbox.ColorMagenta,
+	termbox.ColorCyan,
+	termbox.ColorWhite,
+}
+
+// what the pane under the price can show, cycled with i; "" is the volume
+var chartPanes = []string{"", "rsi(14)", "macd", "atr(14)"}
+
+// chartView is the full screen chart of a single ticker
+type chartView struct {
+	ticker   string
+	rangeIdx int
+	style    chartStyle
+	averages bool        // draw the overlays
+	overlays []indicator // indicators drawn over the price
+	pane     int         // index into chartPanes
+	candles  []Candle    // history over the selected range
+	cursor   int         // selected bar, -1 for the last one
+	bars     int         // number of bars last drawn
+	err      error
+}
+
+// newChartView opens the chart of ticker, overlays that don't parse are
+// skipped
+func newChartView(ticker string, overlays []string) *chartView {
+	chart := &chartView{
+		ticker: ticker,
+		cursor: -1,
+	}
+	for _, s := range overlays {
+		if ind, err := parseIndicator(s); err == nil && ind.overlay() {
+			chart.overlays = append(chart.overlays, ind)
+		}
+	}
+	return chart
+}
+
+func (chart *chartView) rng() string {
+	return chartRanges[chart.rangeIdx].rng
+}
+
+// Load fetches the history of the selected range through the cache
+func (chart *chartView) Load(history *historyCache) {
+	chart.err = history.Refresh([]string{chart.ticker}, chart.rng())
+	chart.candles = history.Get(chart.ticker, chart.rng())
+	chart.cursor = -1
+}
+
+func (chart *chartView) SetRange(id int, history *historyCache) {
+	if id < 0 || id >= len(chartRanges) {
+		return
+	}
+	chart.rangeIdx = id
+	chart.Load(history)
+}
+
+func (chart *chartView) ToggleStyle() {
+	if chart.style == CHART_CANDLES {
+		chart.style = CHART_LINE
+	} else {
+		chart.style = CHART_CANDLES
+	}
+}
+
+func (chart *chartView) ToggleAverages() {
+	chart.averages = !chart.averages
+}
+
+// CyclePane switches the lower pane between the volume and the indicators
+func (chart *chartView) CyclePane() {
+	chart.pane = (chart.pane + 1) % len(chartPanes)
+}
+
+// barSeries picks the value of series at the last candle of every bar
+func barSeries(series []float64, ends []int) []float64 {
+	values := make([]float64, len(ends))
+	for i, end := range ends {
+		values[i] = series[end]
+	}
+	return values
+}
+
+// MoveCursor moves the crosshair by delta bars
+func (chart *chartView) MoveCursor(delta int) {
+	if chart.cursor < 0 {
+		chart.cursor = chart.bars - 1
+	}
+	chart.cursor += delta
+	if chart.cursor >= chart.bars {
+		chart.cursor = chart.bars - 1
+	}
+	if chart.cursor < 0 {
+		chart.cursor = 0
+	}
+}
+
+// MoveCursorTo moves the crosshair to the first bar, or to the last one
+func (chart *chartView) MoveCursorTo(last bool) {
+	chart.cursor = 0
+	if last {
+		chart.cursor = -1
+	}
+}
+
+// bucketCandles merges candles into at most n bars, returning the bars and
+// the index of the last candle of each bar
+func bucketCandles(candles []Candle, n int) ([]Candle, []int) {
+	if n <= 0 {
+		return nil, nil
+	}
+	size := (len(candles) + n - 1) / n
+	if size < 1 {
+		size = 1
+	}
+
+	bars := []Candle{}
+	ends := []int{}
+	for start := 0; start < len(candles); start += size {
+		end := start + size
+		if end > len(candles) {
+			end = len(candles)
+		}
+		bar := candles[start]
+		for _, c := range candles[start+1 : end] {
+			bar.High = math.Max(bar.High, c.High)
+			bar.Low = math.Min(bar.Low, c.Low)
+			bar.Close = c.Close
+			bar.Volume += c.Volume
+		}
+		bars = append(bars, bar)
+		ends = append(ends, end-1)
+	}
+	return bars, ends
+}
+
+func (chart *chartView) timeFormat() string {
+	return rangeTimeFormat(chart.rng())
+}
+
+func rangeTimeFormat(rng string) string {
+	if rng == "1d" || rng == "5d" {
+		return "01/02 15:04"
+	}
+	return layoutUS
+}
+
+// drawRangeTabs draws the selectable ranges from x on the first line
+func drawRangeTabs(win *Win, x int, selected int) int {
+	for id, r := range chartRanges {
+		label := fmt.Sprintf("%d:%s", id+1, r.label)
+		if id == selected {
+			win.print(x, 0, termbox.ColorBlack, termbox.ColorWhite, label)
+		} else {
+			win.print(x, 0, termbox.ColorDefault, termbox.ColorDefault, label)
+		}
+		x += len(label) + 1
+	}
+	return x
+}
+
+// plot maps prices onto the rows of the price area
+type plot struct {
+	win       *Win
+	top, rows int
+	low, high float64
+}
+
+func (p *plot) row(price float64) int {
+	if p.high <= p.low {
+		return p.top + p.rows/2
+	}
+	r := int(math.Round((p.high - price) / (p.high - p.low) * float64(p.rows-1)))
+	return p.top + r
+}
+
+func (chart *chartView) Draw(win *Win) {
+	win.Clear()
+	fg, bg := termbox.ColorDefault, termbox.ColorDefault
+
+	// header: ticker and the ranges
+	win.print(0, 0, fg|termbox.AttrBold, bg, chart.ticker+"  ")
+	x := drawRangeTabs(win, len(chart.ticker)+2, chart.rangeIdx)
+	win.print(x+1, 0, termbox.ColorBlue, bg,
+		"h/l cursor  c candles/line  m overlays  i pane  q back")
+
+	if chart.err != nil && len(chart.candles) == 0 {
+		win.print(0, 2, termbox.ColorRed, bg,
+			fmt.Sprintf("couldn't fetch price history: %v", chart.err))
+		return
+	}
+	if len(chart.candles) == 0 {
+		win.print(0, 2, fg, bg, "no price history")
+		return
+	}
+
+	plotW := win.w - chartAxisWidth
+	volumeRows := (win.h - 3) / 5
+	if volumeRows < 1 {
+		volumeRows = 1
+	}
+	// header, info line, price rows, volume rows, time axis
+	priceRows := win.h - 3 - volumeRows
+	if plotW < 10 || priceRows < 3 {
+		win.print(0, 2, fg, bg, "window too small for a chart")
+		return
+	}
+
+	bars, ends := bucketCandles(chart.candles, plotW)
+	chart.bars = len(bars)
+	if chart.cursor < 0 || chart.cursor >= len(bars) {
+		chart.cursor = len(bars) - 1
+	}
+
+	averages := [][]float64{}
+	if chart.averages {
+		for _, ind := range chart.overlays {
+			averages = append(averages, barSeries(ind.series(chart.candles), ends))
+		}
+	}
+
+	p := &plot{win: win, top: 2, rows: priceRows, low: math.Inf(1),
+		high: math.Inf(-1)}
+	for _, bar := range bars {
+		if chart.style == CHART_CANDLES {
+			p.low = math.Min(p.low, bar.Low)
+			p.high = math.Max(p.high, bar.High)
+		} else {
+			p.low = math.Min(p.low, bar.Close)
+			p.high = math.Max(p.high, bar.Close)
+		}
+	}
+	for _, ma := range averages {
+		for _, v := range ma {
+			if !math.IsNaN(v) {
+				p.low = math.Min(p.low, v)
+				p.high = math.Max(p.high, v)
+			}
+		}
+	}
+
+	chart.drawInfo(win, bars, averages)
+	chart.drawCrosshair(p, bars[chart.cursor], volumeRows)
+
+	if chart.style == CHART_CANDLES {
+		chart.drawCandles(p, bars)
+	} else {
+		chart.drawLine(p, bars)
+	}
+	for id, ma := range averages {
+		drawAverage(p, ma, overlayColors[id%len(overlayColors)])
+	}
+
+	if pane := chartPanes[chart.pane]; pane == "" {
+		chart.drawVolume(win, bars, p.top+priceRows, volumeRows)
+	} else {
+		ind, _ := parseIndicator(pane)
+		chart.drawPane(win, ind, barSeries(ind.series(chart.candles), ends),
+			p.top+priceRows, volumeRows)
+	}
+	chart.drawAxis(p, plotW, bars[chart.cursor].Close)
+
+	// time axis
+	timeY := p.top + priceRows + volumeRows
+	first := bars[0].Time.Format(chart.timeFormat())
+	last := bars[len(bars)-1].Time.Format(chart.timeFormat())
+	win.print(0, timeY, fg, bg, first)
+	if len(bars)-len(last) > len(first) {
+		win.print(len(bars)-len(last), timeY, fg, bg, last)
+	}
+}
+
+func (chart *chartView) drawInfo(win *Win, bars []Candle, averages [][]float64) {
+	bar := bars[chart.cursor]
+	color := colors.up
+	if bar.Close < bar.Open {
+		color = colors.down
+	}
+
+	info := fmt.Sprintf("%s  O %.2f  H %.2f  L %.2f  C %.2f  V %s",
+		bar.Time.Format(chart.timeFormat()), bar.Open, bar.High, bar.Low,
+		bar.Close, float2Str(bar.Volume, 2))
+	win.print(0, 1, color, termbox.ColorDefault, info)
+
+	x := len(info)
+	for id, ma := range averages {
+		name := strings.ToUpper(chart.overlays[id].String())
+		label := fmt.Sprintf("  %s -", name)
+		if !math.IsNaN(ma[chart.cursor]) {
+			label = fmt.Sprintf("  %s %.2f", name, ma[chart.cursor])
+		}
+		win.print(x, 1, overlayColors[id%len(overlayColors)],
+			termbox.ColorDefault, label)
+		x += len(label)
+	}
+}
+
+// drawCrosshair draws the lines through the selected bar and its close,
+// the bars are drawn over it
+func (chart *chartView) drawCrosshair(p *plot, bar Candle, volumeRows int) {
+	color := termbox.ColorBlue
+	closeRow := p.row(bar.Close)
+	for y := p.top; y < p.top+p.rows+volumeRows; y++ {
+		p.win.print(chart.cursor, y, color, termbox.ColorDefault, "│")
+	}
+	for x := 0; x < p.win.w-chartAxisWidth; x++ {
+		ch := "─"
+		if x == chart.cursor {
+			ch = "┼"
+		}
+		p.win.print(x, closeRow, color, termbox.ColorDefault, ch)
+	}
+}
+
+func (chart *chartView) drawCandles(p *plot, bars []Candle) {
+	for x, bar := range bars {
+		color := colors.up
+		if bar.Close < bar.Open {
+			color = colors.down
+		}
+		if x == chart.cursor {
+			color |= termbox.AttrBold
+		}
+
+		for y := p.row(bar.High); y <= p.row(bar.Low); y++ {
+			p.win.print(x, y, color, termbox.ColorDefault, "│")
+		}
+		bodyTop := p.row(math.Max(bar.Open, bar.Close))
+		bodyBottom := p.row(math.Min(bar.Open, bar.Close))
+		for y := bodyTop; y <= bodyBottom; y++ {
+			p.win.print(x, y, color, termbox.ColorDefault, "█")
+		}
+	}
+}
+
+// brailleCanvas is a grid of cells with 2x4 dots each
+type brailleCanvas struct {
+	w, h  int // in cells
+	cells [][]rune
+}
+
+var brailleDots = [4][2]rune{
+	{0x01, 0x08},
+	{0x02, 0x10},
+	{0x04, 0x20},
+	{0x40, 0x80},
+}
+
+func newBrailleCanvas(w, h int) *brailleCanvas {
+	cells := make([][]rune, h)
+	for y := range cells {
+		cells[y] = make([]rune, w)
+	}
+	return &brailleCanvas{w: w, h: h, cells: cells}
+}
+
+func (c *brailleCanvas) set(px, py int) {
+	x, y := px/2, py/4
+	if px < 0 || py < 0 || x >= c.w || y >= c.h {
+		return
+	}
+	c.cells[y][x] |= brailleDots[py%4][px%2]
+}
+
+// line draws a line between two dots
+func (c *brailleCanvas) line(x0, y0, x1, y1 int) {
+	steps := int(math.Max(math.Abs(float64(x1-x0)), math.Abs(float64(y1-y0))))
+	if steps == 0 {
+		c.set(x0, y0)
+		return
+	}
+	for i := 0; i <= steps; i++ {
+		x := x0 + int(math.Round(float64((x1-x0)*i)/float64(steps)))
+		y := y0 + int(math.Round(float64((y1-y0)*i)/float64(steps)))
+		c.set(x, y)
+	}
+}
+
+func (c *brailleCanvas) draw(win *Win, x, y int, fg termbox.Attribute) {
+	for cy, row := range c.cells {
+		for cx, dots := range row {
+			if dots != 0 {
+				win.print(x+cx, y+cy, fg, termbox.ColorDefault,
+					string(brailleBase+dots))
+			}
+		}
+	}
+}
+
+// plotSeries draws values onto a braille canvas covering the price area,
+// one bar per cell, skipping NaN values
+func plotSeries(p *plot, canvas *brailleCanvas, values []float64) {
+	dotY := func(v float64) int {
+		if p.high <= p.low {
+			return canvas.h * 2
+		}
+		return int(math.Round((p.high - v) / (p.high - p.low) *
+			float64(canvas.h*4-1)))
+	}
+
+	prevX, prevY := -1, -1
+	for i, v := range values {
+		if math.IsNaN(v) {
+			prevX = -1
+			continue
+		}
+		x, y := i*2, dotY(v)
+		if prevX >= 0 {
+			canvas.line(prevX, prevY, x, y)
+		} else {
+			canvas.set(x, y)
+		}
+		prevX, prevY = x, y
+	}
+}
+
+func (chart *chartView) drawLine(p *plot, bars []Candle) {
+	color := colors.up
+	if bars[len(bars)-1].Close < bars[0].Close {
+		color = colors.down
+	}
+	canvas := newBrailleCanvas(len(bars), p.rows)
+	plotSeries(p, canvas, closes(bars))
+	canvas.draw(p.win, 0, p.top, color)
+}
+
+func drawAverage(p *plot, values []float64, color termbox.Attribute) {
+	canvas := newBrailleCanvas(len(values), p.rows)
+	plotSeries(p, canvas, values)
+	canvas.draw(p.win, 0, p.top, color)
+}
+
+func (chart *chartView) drawVolume(win *Win, bars []Candle, top, rows int) {
+	maxVolume := 0.0
+	for _, bar := range bars {
+		maxVolume = math.Max(maxVolume, bar.Volume)
+	}
+	if maxVolume == 0 {
+		return
+	}
+
+	for x, bar := range bars {
+		color := colors.up
+		if bar.Close < bar.Open {
+			color = colors.down
+		}
+		// height in eighths of a row
+		eighths := int(math.Round(bar.Volume / maxVolume * float64(rows*8)))
+		for y := top + rows - 1; y >= top && eighths > 0; y-- {
+			level := eighths
+			if level > 8 {
+				level = 8
+			}
+			win.print(x, y, color, termbox.ColorDefault,
+				string(sparkBlocks[level-1]))
+			eighths -= level
+		}
+	}
+	win.print(win.w-chartAxisWidth+1, top, termbox.ColorDefault,
+		termbox.ColorDefault, float2Str(maxVolume, 1))
+}
+
+// drawPane plots an indicator under the price with its value at the cursor,
+// with the 30 and 70 levels for the RSI and the zero line for the MACD
+func (chart *chartView) drawPane(win *Win, ind indicator, values []float64,
+	top, rows int) {
+
+	p := &plot{win: win, top: top, rows: rows, low: math.Inf(1),
+		high: math.Inf(-1)}
+	for _, v := range values {
+		if !math.IsNaN(v) {
+			p.low = math.Min(p.low, v)
+			p.high = math.Max(p.high, v)
+		}
+	}
+	if math.IsInf(p.low, 0) {
+		win.print(0, top, termbox.ColorBlue, termbox.ColorDefault,
+			fmt.Sprintf("%s: not enough history", ind))
+		return
+	}
+
+	levels := []float64{}
+	switch ind.kind {
+	case IND_RSI:
+		p.low, p.high = 0, 100
+		levels = []float64{30, 70}
+	case IND_MACD:
+		p.low, p.high = math.Min(p.low, 0), math.Max(p.high, 0)
+		levels = []float64{0}
+	}
+	for _, level := range levels {
+		for x := range values {
+			win.print(x, p.row(level), termbox.ColorBlue, termbox.ColorDefault, "┈")
+		}
+	}
+
+	canvas := newBrailleCanvas(len(values), rows)
+	plotSeries(p, canvas, values)
+	canvas.draw(win, 0, top, termbox.ColorCyan)
+
+	label := strings.ToUpper(ind.String())
+	if v := values[chart.cursor]; !math.IsNaN(v) {
+		label += " " + strconv.FormatFloat(v, 'f', 2, 64)
+	}
+	win.print(win.w-chartAxisWidth+1, top, termbox.ColorCyan,
+		termbox.ColorDefault, label)
+}
+
+func (chart *chartView) drawAxis(p *plot, x int, cursorPrice float64) {
+	fg, bg := termbox.ColorDefault, termbox.ColorDefault
+	labels := map[int]float64{
+		p.top:              p.high,
+		p.top + p.rows/2:   (p.high + p.low) / 2,
+		p.top + p.rows - 1: p.low,
+	}
+	for y, price := range labels {
+		p.win.print(x+1, y, fg, bg, float2Str(price, 2))
+	}
+	p.win.print(x+1, p.row(cursorPrice), termbox.ColorBlack, termbox.ColorWhite,
+		float2Str(cursorPrice, 2))
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// completer returns where the argument being completed starts in line,
+// which is the input up to the cursor, what it can be completed with and
+// what to add after it when there is a single candidate
+type completer func(editor *LineEditor, line string, arg int) (int, []string, string)
+
+// command is a : command
+type command struct {
+	name     string
+	aliases  []string
+	args     string // arguments for the usage and the help, e.g. "<name>"
+	min, max int    // number of arguments, max -1 for no limit
+	help     string
+	complete completer // nil for no completion of the arguments
+	run      func(editor *LineEditor, args []string)
+}
+
+func (cmd *command) usage() string {
+	return strings.TrimSpace(cmd.name + " " + cmd.args)
+}
+
+// newCommands registers the : commands
+func newCommands() []command {
+	return []command{
+		{"save", []string{"w"}, "<name>", 1, 1, "save the portfolio as name",
+			completeWith((*LineEditor).portfolioNames, "", 1), (*LineEditor).savePortfolio},
+		{"load", []string{"e"}, "<name>", 1, 1, "load a saved portfolio",
+			completeWith((*LineEditor).portfolioNames, "", 1), (*LineEditor).loadPortfolio},
+		{"new", nil, "", 0, 0, "start an empty portfolio", nil,
+			func(editor *LineEditor, args []string) {
+				editor.profile.Tickers = []string{}
+				editor.profile.current = ""
+				editor.profile.sort = nil
+				editor.message = "creating new portfolio"
+			}},
+		{"list", []string{"ls"}, "", 0, 0, "list the saved portfolios", nil,
+			func(editor *LineEditor, args []string) {
+				editor.message = fmt.Sprintf("saved portfolios: '%s'",
+					reflect.ValueOf(editor.profile.Portfolios).MapKeys())
+			}},
+		{"alert", nil, "<ticker> <type> [value]", 2, -1, "add an alert rule",
+			completeWith((*LineEditor).knownSymbols, " ", 1),
+			func(editor *LineEditor, args []string) {
+				editor.alertIndex = -1
+				editor.addAlert(strings.Join(args, " "))
+			}},
+		{"alerts", nil, "", 0, 0, "open the list of alert rules", nil,
+			func(editor *LineEditor, args []string) { *editor.mode = ALERTS }},
+		{"notify", nil, "[exec|webhook <value>]", 0, -1, "set or show the alert notifiers",
+			completeWith(func(*LineEditor) []string {
+				return []string{string(CHANNEL_EXEC), string(CHANNEL_WEBHOOK)}
+			}, " ", 1), (*LineEditor).setNotifier},
+		{"column", nil, "add|del|hide|show|move|width <name> [value]", 2, -1,
+			"add, delete, hide, show, move or resize a column", completeColumn,
+			(*LineEditor).editColumns},
+		{"columns", []string{"cols"}, "", 0, 0, "open the column chooser", nil,
+			func(editor *LineEditor, args []string) { *editor.mode = COLUMNS }},
+		{"sort", nil, "[spec|manual]", 0, -1, "sort by columns, e.g. Volume desc",
+			completeSort, func(editor *LineEditor, args []string) {
+				editor.setSort(strings.Join(args, " "))
+			}},
+		{"filter", nil, "[expr]", 0, -1, "show only the tickers for which expr holds",
+			nil, func(editor *LineEditor, args []string) {
+				editor.setFilter(strings.Join(args, " "))
+			}},
+		{"overlays", nil, "[indicator...]", 0, -1, "set the indicators drawn over charts",
+			nil, (*LineEditor).setOverlays},
+		{"compare", []string{"cmp"}, "<ticker...>", 1, -1, "compare tickers on one chart",
+			completeWith((*LineEditor).knownSymbols, " "),
+			func(editor *LineEditor, args []string) {
+				editor.compareTickers = args
+				*editor.mode = COMPARE
+			}},
+		{"note", nil, "[text]", 0, -1, "set the note of the ticker, no text removes it",
+			nil, func(editor *LineEditor, args []string) {
+				editor.setNote(editor.selectedTickers(editor.quoteIndex),
+					strings.Join(args, " "))
+			}},
+		{"set", []string{"se"}, "[option[=value]...]", 0, -1,
+			"set options, e.g. refresh=15s or nomarket, ? shows them",
+			completeOption, (*LineEditor).setOptions},
+		{"source", []string{"so"}, "<file>", 1, 1, "run the : commands of a file",
+			nil, (*LineEditor).source},
+		{"help", []string{"h"}, "[words]", 0, -1, "show the help, searching for words",
+			completeWith((*LineEditor).commandNames, ""),
+			func(editor *LineEditor, args []string) {
+				editor.helpQuery = strings.Join(args, " ")
+				*editor.mode = HELP
+			}},
+	}
+}
+
+// findCommand returns the command called name or one of its aliases
+func (editor *LineEditor) findCommand(name string) *command {
+	for id := range editor.commands {
+		cmd := &editor.commands[id]
+		if cmd.name == name {
+			return cmd
+		}
+		for _, alias := range cmd.aliases {
+			if alias == name {
+				return cmd
+			}
+		}
+	}
+	return nil
+}
+
+// commandNames are the names of the : commands
+func (editor *LineEditor) commandNames() []string {
+	names := []string{}
+	for _, cmd := range editor.commands {
+		names = append(names, cmd.name)
+	}
+	return names
+}
+
+// commandHelp describes the : commands for the help
+func (editor *LineEditor) commandHelp() []helpEntry {
+	entries := []helpEntry{}
+	for _, cmd := range editor.commands {
+		desc := cmd.help
+		if len(cmd.aliases) > 0 {
+			desc += fmt.Sprintf(" (also :%s)", strings.Join(cmd.aliases, ", :"))
+		}
+		entries = append(entries, helpEntry{":" + cmd.usage(), "", desc})
+	}
+	return entries
+}
+
+// RunCommand runs a command line such as `column hide "Avg Volume"`,
+// reporting errors in the command window
+func (editor *LineEditor) RunCommand(line string) {
+	args, err := splitArgs(line)
+	if err != nil {
+		editor.PrintErrorf("%v", err)
+		return
+	}
+	if len(args) == 0 {
+		return
+	}
+
+	cmd := editor.findCommand(args[0])
+	if cmd == nil && strings.HasSuffix(args[0], "?") {
+		// :set? is :set ?
+		if cmd = editor.findCommand(strings.TrimSuffix(args[0], "?")); cmd != nil {
+			args = append([]string{args[0], "?"}, args[1:]...)
+		}
+	}
+	if cmd == nil {
+		editor.PrintErrorf("could not recognize command '%s'", args[0])
+		return
+	}
+	args = args[1:]
+	if len(args) < cmd.min || cmd.max >= 0 && len(args) > cmd.max {
+		editor.PrintErrorf("usage: %s", cmd.usage())
+		return
+	}
+	cmd.run(editor, args)
+}
+
+// splitArgs splits a command line into words separated by spaces. Quotes
+// keep spaces in a word, a backslash escapes the next character outside of
+// single quotes.
+func splitArgs(line string) ([]string, error) {
+	args := []string{}
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("missing closing quote %c", quote)
+	}
+	if escaped {
+		return nil, fmt.Errorf("nothing to escape at the end of the line")
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
+
+// savePortfolio saves the tickers and settings as portfolio args[0]
+func (editor *LineEditor) savePortfolio(args []string) {
+	portfolioName := args[0]
+	editor.profile.Portfolios[portfolioName] = portfolio{
+		Tickers: append([]string{}, editor.profile.Tickers...),
+		Columns: append([]columnSetting{}, editor.profile.columns...),
+		Sort:    append([]sortKey{}, editor.profile.sort...),
+	}
+	editor.profile.current = portfolioName
+	editor.message = fmt.Sprintf("saved portfolio as '%s'", portfolioName)
+}
+
+// loadPortfolio loads portfolio args[0]
+func (editor *LineEditor) loadPortfolio(args []string) {
+	portfolioName := args[0]
+	portfolio, ok := editor.profile.Portfolios[portfolioName]
+	if !ok {
+		editor.PrintErrorf("portfolio not found: %s", portfolioName)
+		return
+	}
+	editor.profile.Tickers = append([]string{}, portfolio.Tickers...)
+	editor.profile.columns = append([]columnSetting{}, portfolio.Columns...)
+	editor.profile.sort = append([]sortKey{}, portfolio.Sort...)
+	editor.profile.current = portfolioName
+	editor.message = fmt.Sprintf("loaded portfolio '%s'", portfolioName)
+}
+
+// source runs the commands of file args[0], reporting the lines that failed
+func (editor *LineEditor) source(args []string) {
+	errs, err := editor.sourceFile(args[0])
+	if err != nil {
+		editor.PrintErrorf("couldn't source %s: %v", args[0], err)
+		return
+	}
+	if len(errs) > 0 {
+		editor.PrintErrorf("%s", strings.Join(errs, "; "))
+		return
+	}
+	editor.message = fmt.Sprintf("sourced %s", args[0])
+}
+
+// sourceFile runs the file at path one line at a time as if each was typed
+// after :, skipping empty lines and comments starting with " or #. It
+// returns the errors of the lines that failed, e.g. "monmoprc.cmds:3: ...".
+func (editor *LineEditor) sourceFile(path string) ([]string, error) {
+	abs, err := filepath.Abs(expandHome(path))
+	if err != nil {
+		return nil, err
+	}
+	for _, sourcing := range editor.sourcing {
+		if sourcing == abs {
+			return nil, fmt.Errorf("already being sourced")
+		}
+	}
+	file, err := os.Open(abs)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	editor.sourcing = append(editor.sourcing, abs)
+	defer func() { editor.sourcing = editor.sourcing[:len(editor.sourcing)-1] }()
+
+	errs := []string{}
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "\"") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		editor.promptError = ""
+		editor.RunCommand(strings.TrimPrefix(line, ":"))
+		if editor.promptError != "" {
+			errs = append(errs, fmt.Sprintf("%s:%d: %s", filepath.Base(path), n,
+				editor.promptError))
+		}
+	}
+	editor.promptError = ""
+	return errs, scanner.Err()
+}
+
+// expandHome replaces a leading ~ of path with the home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	if u, err := user.Current(); err == nil {
+		return filepath.Join(u.HomeDir, path[1:])
+	}
+	return path
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitArgs(t *testing.T) {
+	for _, test := range []struct {
+		line string
+		want []string
+	}{
+		{"", []string{}},
+		{"   ", []string{}},
+		{"load work", []string{"load", "work"}},
+		{"  load   work  ", []string{"load", "work"}},
+		{"column\thide Volume", []string{"column", "hide", "Volume"}},
+		{`column hide "Avg Volume"`, []string{"column", "hide", "Avg Volume"}},
+		{`note 'a "quoted" word'`, []string{"note", `a "quoted" word`}},
+		{`note "it's"`, []string{"note", "it's"}},
+		{`note a\ b`, []string{"note", "a b"}},
+		{`note \"hi\"`, []string{"note", `"hi"`}},
+		{`note "say \"hi\""`, []string{"note", `say "hi"`}},
+		{`note 'no \escape'`, []string{"note", `no \escape`}},
+		{`note ""`, []string{"note", ""}},
+		{`note '' x`, []string{"note", "", "x"}},
+		{`note ab"c d"e`, []string{"note", "abc de"}},
+	} {
+		args, err := splitArgs(test.line)
+		if assert.NoError(t, err, test.line) {
+			assert.Equal(t, test.want, args, test.line)
+		}
+	}
+}
+
+func TestSplitArgsErrors(t *testing.T) {
+	for _, test := range []struct {
+		line, err string
+	}{
+		{`column hide "Avg Volume`, "missing closing quote \""},
+		{`note 'it`, "missing closing quote '"},
+		{`note "it's`, "missing closing quote \""},
+		{`note trailing\`, "nothing to escape at the end of the line"},
+	} {
+		_, err := splitArgs(test.line)
+		assert.EqualError(t, err, test.err, test.line)
+	}
+}
+
+func testEditor() *LineEditor {
+	return &LineEditor{
+		profile: &profile{
+			Portfolios: map[string]portfolio{"work": {Tickers: []string{"AAPL"}}},
+			Tickers:    []string{"MSFT"},
+		},
+		commands: newCommands(),
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	editor := testEditor()
+	editor.RunCommand("load work")
+	assert.Equal(t, "", editor.promptError)
+	assert.Equal(t, "loaded portfolio 'work'", editor.message)
+	assert.Equal(t, []string{"AAPL"}, editor.profile.Tickers)
+
+	// aliases, and quotes around a whole name
+	editor = testEditor()
+	editor.RunCommand(`w "my list"`)
+	assert.Equal(t, "", editor.promptError)
+	assert.Contains(t, editor.profile.Portfolios, "my list")
+}
+
+func TestRunCommandErrors(t *testing.T) {
+	for _, test := range []struct {
+		line, err string
+	}{
+		{"save", "usage: save <name>"},
+		{"load a b", "usage: load <name>"},
+		{"e", "usage: load <name>"}, // the usage names the command, not the alias
+		{"new now", "usage: new"},
+		{"alert AAPL", "usage: alert <ticker> <type> [value]"},
+		{"compare", "usage: compare <ticker...>"},
+		{"column hide", "usage: column add|del|hide|show|move|width <name> [value]"},
+		{"lod work", "could not recognize command 'lod'"},
+		{"Load work", "could not recognize command 'Load'"},
+		{`load "work`, "missing closing quote \""},
+		{"load nowhere", "portfolio not found: nowhere"},
+	} {
+		editor := testEditor()
+		editor.RunCommand(test.line)
+		assert.Equal(t, test.err, editor.promptError, test.line)
+		assert.Equal(t, []string{"MSFT"}, editor.profile.Tickers, test.line)
+	}
+}
+
+func TestRunCommandIgnoresEmptyLines(t *testing.T) {
+	for _, line := range []string{"", "   ", "\t"} {
+		editor := testEditor()
+		editor.RunCommand(line)
+		assert.Equal(t, "", editor.promptError)
+		assert.Equal(t, "", editor.message)
+	}
+}
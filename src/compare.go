@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/nsf/termbox-go"
+)
+
+// colors of the series in a comparison, in order
+var compareColors = []termbox.Attribute{
+	termbox.ColorCyan,
+	termbox.ColorYellow,
+	termbox.ColorMagenta,
+	termbox.ColorGreen,
+	termbox.ColorRed,
+	termbox.ColorBlue,
+	termbox.ColorWhite,
+}
+
+// default range of a comparison, a quarter
+const compareDefaultRange = 3
+
+// compareView plots several tickers as percent change from a common start
+type compareView struct {
+	tickers  []string
+	rangeIdx int
+	series   [][]Candle // history of each ticker, from the common start
+	cursor   int        // column of the crosshair, -1 for the last one
+	width    int        // width of the plot last drawn
+	err      error
+}
+
+func newCompareView(tickers []string) *compareView {
+	upper := make([]string, len(tickers))
+	for id, ticker := range tickers {
+		upper[id] = strings.ToUpper(ticker)
+	}
+	return &compareView{
+		tickers:  upper,
+		rangeIdx: compareDefaultRange,
+		cursor:   -1,
+	}
+}
+
+func (cmp *compareView) rng() string {
+	return chartRanges[cmp.rangeIdx].rng
+}
+
+// Load fetches the history of every ticker and trims them to the latest
+// first bar among them, so that all series start on the same date
+func (cmp *compareView) Load(history *historyCache) {
+	cmp.err = history.Refresh(cmp.tickers, cmp.rng())
+	cmp.cursor = -1
+
+	start := time.Time{}
+	cmp.series = make([][]Candle, len(cmp.tickers))
+	for id, ticker := range cmp.tickers {
+		cmp.series[id] = history.Get(ticker, cmp.rng())
+		if len(cmp.series[id]) > 0 && cmp.series[id][0].Time.After(start) {
+			start = cmp.series[id][0].Time
+		}
+	}
+
+	for id, candles := range cmp.series {
+		for len(candles) > 0 && candles[0].Time.Before(start) {
+			candles = candles[1:]
+		}
+		cmp.series[id] = candles
+	}
+}
+
+func (cmp *compareView) SetRange(id int, history *historyCache) {
+	if id < 0 || id >= len(chartRanges) {
+		return
+	}
+	cmp.rangeIdx = id
+	cmp.Load(history)
+}
+
+func (cmp *compareView) MoveCursor(delta int) {
+	if cmp.cursor < 0 {
+		cmp.cursor = cmp.width - 1
+	}
+	cmp.cursor += delta
+	if cmp.cursor >= cmp.width {
+		cmp.cursor = cmp.width - 1
+	}
+	if cmp.cursor < 0 {
+		cmp.cursor = 0
+	}
+}
+
+func (cmp *compareView) MoveCursorTo(last bool) {
+	cmp.cursor = 0
+	if last {
+		cmp.cursor = -1
+	}
+}
+
+// percentChanges is the change of each close from the first one
+func percentChanges(candles []Candle) []float64 {
+	values := make([]float64, len(candles))
+	for id, c := range candles {
+		if candles[0].Close == 0 {
+			values[id] = math.NaN()
+		} else {
+			values[id] = (c.Close/candles[0].Close - 1) * 100
+		}
+	}
+	return values
+}
+
+// valueAt is the last value at or before t, NaN if there is none
+func valueAt(candles []Candle, values []float64, t time.Time) float64 {
+	v := math.NaN()
+	for id, c := range candles {
+		if c.Time.After(t) {
+			break
+		}
+		v = values[id]
+	}
+	return v
+}
+
+func (cmp *compareView) Draw(win *Win) {
+	win.Clear()
+	fg, bg := termbox.ColorDefault, termbox.ColorDefault
+
+	win.print(0, 0, fg|termbox.AttrBold, bg, "Compare  ")
+	x := drawRangeTabs(win, 9, cmp.rangeIdx)
+	win.print(x+1, 0, termbox.ColorBlue, bg, "h/l cursor  q back")
+
+	start, end := time.Time{}, time.Time{}
+	changes := make([][]float64, len(cmp.series))
+	low, high := 0.0, 0.0
+	for id, candles := range cmp.series {
+		if len(candles) == 0 {
+			continue
+		}
+		changes[id] = percentChanges(candles)
+		for _, v := range changes[id] {
+			if !math.IsNaN(v) {
+				low = math.Min(low, v)
+				high = math.Max(high, v)
+			}
+		}
+		if start.IsZero() || candles[0].Time.Before(start) {
+			start = candles[0].Time
+		}
+		if candles[len(candles)-1].Time.After(end) {
+			end = candles[len(candles)-1].Time
+		}
+	}
+
+	if start.IsZero() {
+		msg := "no price history"
+		if cmp.err != nil {
+			msg = fmt.Sprintf("couldn't fetch price history: %v", cmp.err)
+		}
+		win.print(0, 2, termbox.ColorRed, bg, msg)
+		return
+	}
+
+	plotW := win.w - chartAxisWidth
+	// header, legend, plot rows, time axis
+	rows := win.h - 3
+	if plotW < 10 || rows < 3 {
+		win.print(0, 2, fg, bg, "window too small for a chart")
+		return
+	}
+	cmp.width = plotW
+	if cmp.cursor < 0 || cmp.cursor >= plotW {
+		cmp.cursor = plotW - 1
+	}
+
+	span := end.Sub(start)
+	timeAt := func(x int) time.Time {
+		return start.Add(time.Duration(float64(span) * float64(x) /
+			float64(plotW-1)))
+	}
+	cursorTime := timeAt(cmp.cursor)
+
+	// legend with the change of each series at the crosshair
+	timeLabel := cursorTime.Format(rangeTimeFormat(cmp.rng())) + "  "
+	win.print(0, 1, fg, bg, timeLabel)
+	x = len(timeLabel)
+	for id, ticker := range cmp.tickers {
+		color := compareColors[id%len(compareColors)]
+		label := fmt.Sprintf("■ %s -  ", ticker)
+		if changes[id] != nil {
+			v := valueAt(cmp.series[id], changes[id], cursorTime)
+			if !math.IsNaN(v) {
+				label = fmt.Sprintf("■ %s %+.2f%%  ", ticker, v)
+			}
+		}
+		win.print(x, 1, color, bg, label)
+		x += len([]rune(label))
+	}
+
+	p := &plot{win: win, top: 2, rows: rows, low: low, high: high}
+
+	// zero line and crosshair
+	for x := 0; x < plotW; x++ {
+		win.print(x, p.row(0), termbox.ColorBlue, bg, "┈")
+	}
+	for y := p.top; y < p.top+rows; y++ {
+		win.print(cmp.cursor, y, termbox.ColorBlue, bg, "│")
+	}
+
+	for id, candles := range cmp.series {
+		if len(candles) == 0 {
+			continue
+		}
+		canvas := newBrailleCanvas(plotW, rows)
+		dotY := func(v float64) int {
+			if high <= low {
+				return rows * 2
+			}
+			return int(math.Round((high - v) / (high - low) * float64(rows*4-1)))
+		}
+		prevX, prevY := -1, -1
+		for i, c := range candles {
+			v := changes[id][i]
+			if math.IsNaN(v) {
+				continue
+			}
+			dotX := 0
+			if span > 0 {
+				dotX = int(math.Round(float64(c.Time.Sub(start)) / float64(span) *
+					float64(plotW*2-1)))
+			}
+			if prevX >= 0 {
+				canvas.line(prevX, prevY, dotX, dotY(v))
+			} else {
+				canvas.set(dotX, dotY(v))
+			}
+			prevX, prevY = dotX, dotY(v)
+		}
+		canvas.draw(win, 0, p.top, compareColors[id%len(compareColors)])
+	}
+
+	// percent axis
+	labels := map[int]float64{
+		p.top:            high,
+		p.row(0):         0,
+		p.top + rows - 1: low,
+	}
+	for y, v := range labels {
+		win.print(plotW+1, y, fg, bg, fmt.Sprintf("%+.1f%%", v))
+	}
+
+	timeY := p.top + rows
+	format := rangeTimeFormat(cmp.rng())
+	first, last := start.Format(format), end.Format(format)
+	win.print(0, timeY, fg, bg, first)
+	if plotW-len(last) > len(first) {
+		win.print(plotW-len(last), timeY, fg, bg, last)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nsf/termbox-go"
+)
+
+// most candidates shown at once above the command line
+const completionRows = 8
+
+// completion is the state of Tab completion on the command line
+type completion struct {
+	candidates []string
+	index      int    // candidate in the input, -1 for the common prefix
+	start, end int    // bytes of the input replaced by the candidate
+	suffix     string // added after a lone candidate, e.g. " " after a command
+}
+
+// completions returns where the word being completed starts in line, which
+// is the input up to the cursor, what it can be completed with and what to
+// add after it when there is a single candidate
+func (editor *LineEditor) completions(line string) (int, []string, string) {
+	switch editor.cmd {
+	case 'a':
+		// tickers are separated by commas or spaces
+		return strings.LastIndexAny(line, ", ") + 1, editor.knownSymbols(), ""
+	case ':':
+	default:
+		return 0, nil, ""
+	}
+
+	fields := strings.Fields(line)
+	arg := len(fields) - 1 // argument being typed, 0 for the command
+	if len(fields) == 0 || strings.HasSuffix(line, " ") {
+		arg++
+	}
+	if arg == 0 {
+		return skipSpaces(line, 0), editor.commandNames(), " "
+	}
+	if cmd := editor.findCommand(fields[0]); cmd != nil && cmd.complete != nil {
+		return cmd.complete(editor, line, arg)
+	}
+	return argStart(line, arg), nil, ""
+}
+
+// completeWith completes the arguments at the positions given, or all of
+// them if none are, with the candidates of source
+func completeWith(source func(editor *LineEditor) []string, suffix string,
+	positions ...int) completer {
+
+	return func(editor *LineEditor, line string, arg int) (int, []string, string) {
+		if len(positions) == 0 {
+			return argStart(line, arg), source(editor), suffix
+		}
+		for _, position := range positions {
+			if arg == position {
+				return argStart(line, arg), source(editor), suffix
+			}
+		}
+		return argStart(line, arg), nil, ""
+	}
+}
+
+// completeSort completes the column names of a sort spec, which may have
+// spaces and are separated by commas
+func completeSort(editor *LineEditor, line string, arg int) (int, []string, string) {
+	start := argStart(line, 1)
+	if comma := strings.LastIndex(line, ","); comma >= start {
+		start = skipSpaces(line, comma+1)
+	}
+	return start, editor.columnNames(false), ""
+}
+
+// completeColumn completes the subcommands of :column and then the names
+// of the columns
+func completeColumn(editor *LineEditor, line string, arg int) (int, []string, string) {
+	if arg == 1 {
+		return argStart(line, 1), []string{"add", "del", "hide", "show", "move", "width"}, " "
+	}
+	switch strings.Fields(line)[1] {
+	case "del":
+		return argStart(line, 2), editor.columnNames(true), ""
+	case "hide", "show", "move", "width":
+		return argStart(line, 2), editor.columnNames(false), ""
+	}
+	return argStart(line, arg), nil, ""
+}
+
+// skipSpaces returns the first byte from i on in s that isn't a space
+func skipSpaces(s string, i int) int {
+	for i < len(s) && s[i] == ' ' {
+		i++
+	}
+	return i
+}
+
+// argStart returns where field n of line starts, or the end of line if it
+// wasn't started
+func argStart(line string, n int) int {
+	i := skipSpaces(line, 0)
+	for ; n > 0 && i < len(line); n-- {
+		for i < len(line) && line[i] != ' ' {
+			i++
+		}
+		i = skipSpaces(line, i)
+	}
+	return i
+}
+
+func (editor *LineEditor) portfolioNames() []string {
+	names := []string{}
+	for name := range editor.profile.Portfolios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// columnNames are the names of the columns in display order, or only those
+// of the computed columns if custom is set
+func (editor *LineEditor) columnNames(custom bool) []string {
+	names := []string{}
+	if custom {
+		for _, c := range editor.profile.Columns {
+			names = append(names, c.Name)
+		}
+		return names
+	}
+	for _, setting := range editor.profile.columns {
+		names = append(names, setting.Name)
+	}
+	return names
+}
+
+// knownSymbols are the tickers of every portfolio, the market indices and
+// the tickers with tags or notes
+func (editor *LineEditor) knownSymbols() []string {
+	seen := map[string]bool{}
+	add := func(tickers ...string) {
+		for _, ticker := range tickers {
+			seen[strings.ToUpper(ticker)] = true
+		}
+	}
+	add(editor.profile.Tickers...)
+	add(editor.profile.listOption("markets")...)
+	for _, p := range editor.profile.Portfolios {
+		add(p.Tickers...)
+	}
+	for ticker := range editor.profile.Tags {
+		add(ticker)
+	}
+	for ticker := range editor.profile.Notes {
+		add(ticker)
+	}
+
+	symbols := []string{}
+	for ticker := range seen {
+		symbols = append(symbols, ticker)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// complete completes the word before the cursor. The first Tab inserts
+// the lone candidate or what the candidates have in common, the next ones
+// go through the candidates, backwards if delta is negative.
+func (editor *LineEditor) complete(delta int) {
+	if c := editor.completion; c != nil {
+		if len(c.candidates) < 2 {
+			return
+		}
+		c.index += delta
+		if c.index >= len(c.candidates) {
+			c.index = 0
+		} else if c.index < 0 {
+			c.index = len(c.candidates) - 1
+		}
+		editor.replaceWord(c.candidates[c.index])
+		return
+	}
+
+	line := editor.input[:editor.cursor]
+	start, all, suffix := editor.completions(line)
+	word := strings.ToLower(line[start:])
+	candidates := []string{}
+	for _, candidate := range all {
+		if strings.HasPrefix(strings.ToLower(candidate), word) {
+			candidates = append(candidates, candidate)
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	editor.completion = &completion{candidates: candidates, index: -1,
+		start: start, end: editor.cursor, suffix: suffix}
+	if len(candidates) == 1 {
+		editor.replaceWord(candidates[0] + suffix)
+		return
+	}
+	prefix := candidates[0]
+	for _, candidate := range candidates[1:] {
+		for !strings.HasPrefix(strings.ToLower(candidate), strings.ToLower(prefix)) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	if prefix != line[start:] {
+		editor.replaceWord(prefix)
+	}
+}
+
+// replaceWord puts s in place of the word being completed
+func (editor *LineEditor) replaceWord(s string) {
+	c := editor.completion
+	editor.input = editor.input[:c.start] + s + editor.input[c.end:]
+	c.end = c.start + len(s)
+	editor.cursor = c.end
+}
+
+// drawCompletion lists the candidates above the command line from column x,
+// the one in the input highlighted
+func (editor *LineEditor) drawCompletion(x int) {
+	c := editor.completion
+	if c == nil || len(c.candidates) < 2 {
+		return
+	}
+
+	width := 0
+	for _, candidate := range c.candidates {
+		if w := displayWidth(candidate) + 2; w > width {
+			width = w
+		}
+	}
+	if x+width > editor.commandWin.w {
+		x = editor.commandWin.w - width
+	}
+	if x < 0 {
+		x = 0
+	}
+
+	rows := len(c.candidates)
+	if rows > completionRows {
+		rows = completionRows
+	}
+	if rows > editor.commandWin.y {
+		rows = editor.commandWin.y
+	}
+	first := 0
+	if c.index >= rows {
+		first = c.index - rows + 1
+	}
+
+	win := &Win{w: editor.commandWin.w, h: rows, x: 0, y: editor.commandWin.y - rows}
+	for row := 0; row < rows; row++ {
+		fg, bg := termbox.ColorWhite, termbox.ColorBlue
+		if first+row == c.index {
+			fg, bg = colors.selectedFg, colors.selectedBg
+		}
+		candidate := c.candidates[first+row]
+		win.print(x, row, fg, bg, " "+candidate+
+			strings.Repeat(" ", width-displayWidth(candidate)-1))
+	}
+}
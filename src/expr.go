@@ -0,0 +1,502 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// expression language for computed columns, alerts and filters, e.g.
+// "(Last - Low52)/(High52 - Low52)" or "rsi(14) < 30 and Last > sma(200)"
+//
+//   cond   = and { "or" and }
+//   and    = cmp { "and" cmp }
+//   cmp    = expr [ ("<" | "<=" | ">" | ">=" | "==" | "!=") expr ]
+//   expr   = term { ("+" | "-") term }
+//   term   = unary { ("*" | "/") unary }
+//   unary  = "-" unary | factor
+//   factor = number | field | "#" tag | func "(" cond { "," cond } ")" |
+//            "(" cond ")"
+//
+// Comparisons and and/or evaluate to 1 for true and 0 for false, as does
+// #tag for whether the ticker has the tag.
+
+// exprEnv is what an expression is evaluated against
+type exprEnv struct {
+	quote      Quote
+	indicators *indicatorCache              // nil when indicators aren't available
+	tags       func(ticker string) []string // nil when tags aren't available
+}
+
+type exprNode interface {
+	eval(env exprEnv) float64
+}
+
+// shorter names for the Quote fields, matching the column labels
+var exprAliases = map[string]string{
+	"Last":     "LastTrade",
+	"Price":    "LastTrade",
+	"Chg":      "Change",
+	"ChgPct":   "ChangePct",
+	"PE":       "PeRatio",
+	"Divd":     "Dividend",
+	"MktCap":   "MarketCap",
+	"PreChg":   "PreOpen",
+	"AfterChg": "AfterHours",
+}
+
+var exprFuncs = map[string]func(args []float64) float64{
+	"abs":  func(args []float64) float64 { return math.Abs(args[0]) },
+	"sqrt": func(args []float64) float64 { return math.Sqrt(args[0]) },
+	"log":  func(args []float64) float64 { return math.Log(args[0]) },
+	"min":  func(args []float64) float64 { return math.Min(args[0], args[1]) },
+	"max":  func(args []float64) float64 { return math.Max(args[0], args[1]) },
+}
+
+var exprFuncArity = map[string]int{
+	"abs": 1, "sqrt": 1, "log": 1, "min": 2, "max": 2,
+}
+
+type numberNode float64
+
+// tagNode is 1 if the ticker has the tag
+type tagNode string
+
+func (n tagNode) eval(env exprEnv) float64 {
+	if env.tags == nil {
+		return 0
+	}
+	return boolValue(hasTag(env.tags(env.quote.Ticker), string(n)))
+}
+
+func (n numberNode) eval(env exprEnv) float64 {
+	return float64(n)
+}
+
+type fieldNode struct {
+	name string
+	get  func(q Quote) float64
+}
+
+func (n fieldNode) eval(env exprEnv) float64 {
+	return n.get(env.quote)
+}
+
+type indicatorNode struct {
+	ind indicator
+}
+
+func (n indicatorNode) eval(env exprEnv) float64 {
+	if env.indicators == nil {
+		return math.NaN()
+	}
+	return env.indicators.Value(env.quote.Ticker, n.ind)
+}
+
+type unaryNode struct {
+	x exprNode
+}
+
+func (n unaryNode) eval(env exprEnv) float64 {
+	return -n.x.eval(env)
+}
+
+type binaryNode struct {
+	op   string
+	l, r exprNode
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// truthy is false for 0 and for missing values
+func truthy(v float64) bool {
+	return v != 0 && !math.IsNaN(v)
+}
+
+func (n binaryNode) eval(env exprEnv) float64 {
+	l, r := n.l.eval(env), n.r.eval(env)
+	switch n.op {
+	case "+":
+		return l + r
+	case "-":
+		return l - r
+	case "*":
+		return l * r
+	case "/":
+		if r == 0 {
+			return math.NaN()
+		}
+		return l / r
+	case "<":
+		return boolValue(l < r)
+	case "<=":
+		return boolValue(l <= r)
+	case ">":
+		return boolValue(l > r)
+	case ">=":
+		return boolValue(l >= r)
+	case "==":
+		return boolValue(l == r)
+	case "!=":
+		return boolValue(l != r)
+	case "and":
+		return boolValue(truthy(l) && truthy(r))
+	case "or":
+		return boolValue(truthy(l) || truthy(r))
+	}
+	return math.NaN()
+}
+
+type callNode struct {
+	fn   func(args []float64) float64
+	args []exprNode
+}
+
+func (n callNode) eval(env exprEnv) float64 {
+	args := make([]float64, len(n.args))
+	for id, arg := range n.args {
+		args[id] = arg.eval(env)
+	}
+	return n.fn(args)
+}
+
+type exprParser struct {
+	tokens  []string
+	columns []int // column of each token, from 1
+	pos     int
+}
+
+// parseExpr compiles an expression over the numeric fields of Quote
+func parseExpr(s string) (exprNode, error) {
+	tokens, columns, err := tokenizeExpr(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+
+	p := &exprParser{tokens: tokens, columns: columns}
+	node, err := p.cond()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s' at column %d", p.tokens[p.pos],
+			p.columns[p.pos])
+	}
+	return node, nil
+}
+
+// tokenizeExpr splits s into tokens and returns the column each starts at
+func tokenizeExpr(s string) ([]string, []int, error) {
+	tokens := []string{}
+	columns := []int{}
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		if !unicode.IsSpace(r) {
+			columns = append(columns, i+1)
+		}
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.ContainsRune("<>=!", r):
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				tokens = append(tokens, string(runes[i:i+2]))
+				i += 2
+			} else if r == '<' || r == '>' {
+				tokens = append(tokens, string(r))
+				i++
+			} else {
+				return nil, nil, fmt.Errorf("unexpected character '%c' at column %d", r,
+					i+1)
+			}
+		case r == '#':
+			j := i + 1
+			for j < len(runes) && !unicode.IsSpace(runes[j]) &&
+				!strings.ContainsRune("()<>=!,", runes[j]) {
+				j++
+			}
+			if j == i+1 {
+				return nil, nil, fmt.Errorf("missing tag after '#' at column %d", i+1)
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		case strings.ContainsRune("+-*/(),", r):
+			tokens = append(tokens, string(r))
+			i++
+		case unicode.IsDigit(r) || r == '.':
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		case unicode.IsLetter(r):
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j])) {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		default:
+			return nil, nil, fmt.Errorf("unexpected character '%c' at column %d", r, i+1)
+		}
+	}
+	return tokens, columns, nil
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+// column is where the token last read starts
+func (p *exprParser) column() int {
+	return p.columns[p.pos-1]
+}
+
+func (p *exprParser) expect(token string) error {
+	if got := p.next(); got != token {
+		if got == "" {
+			return fmt.Errorf("expected '%s' at end of expression", token)
+		}
+		return fmt.Errorf("expected '%s' but found '%s' at column %d", token, got,
+			p.column())
+	}
+	return nil
+}
+
+func (p *exprParser) cond() (exprNode, error) {
+	node, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for strings.ToLower(p.peek()) == "or" {
+		p.next()
+		r, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		node = binaryNode{op: "or", l: node, r: r}
+	}
+	return node, nil
+}
+
+func (p *exprParser) and() (exprNode, error) {
+	node, err := p.cmp()
+	if err != nil {
+		return nil, err
+	}
+	for strings.ToLower(p.peek()) == "and" {
+		p.next()
+		r, err := p.cmp()
+		if err != nil {
+			return nil, err
+		}
+		node = binaryNode{op: "and", l: node, r: r}
+	}
+	return node, nil
+}
+
+func (p *exprParser) cmp() (exprNode, error) {
+	node, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	switch op := p.peek(); op {
+	case "<", "<=", ">", ">=", "==", "!=":
+		p.next()
+		r, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		node = binaryNode{op: op, l: node, r: r}
+	}
+	return node, nil
+}
+
+func (p *exprParser) expr() (exprNode, error) {
+	node, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "+" || p.peek() == "-" {
+		op := p.next()
+		r, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		node = binaryNode{op: op, l: node, r: r}
+	}
+	return node, nil
+}
+
+func (p *exprParser) term() (exprNode, error) {
+	node, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "*" || p.peek() == "/" {
+		op := p.next()
+		r, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		node = binaryNode{op: op, l: node, r: r}
+	}
+	return node, nil
+}
+
+func (p *exprParser) unary() (exprNode, error) {
+	if p.peek() == "-" {
+		p.next()
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryNode{x: x}, nil
+	}
+	return p.factor()
+}
+
+func (p *exprParser) factor() (exprNode, error) {
+	token := p.next()
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case token == "(":
+		node, err := p.cond()
+		if err != nil {
+			return nil, err
+		}
+		return node, p.expect(")")
+	case unicode.IsDigit(rune(token[0])) || token[0] == '.':
+		f, err := strconv.ParseFloat(token, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s' at column %d", token, p.column())
+		}
+		return numberNode(f), nil
+	case token[0] == '#':
+		return tagNode(strings.ToLower(token[1:])), nil
+	case unicode.IsLetter(rune(token[0])):
+		if p.peek() == "(" {
+			return p.call(token)
+		}
+		node, err := newFieldNode(token)
+		if err != nil {
+			return nil, fmt.Errorf("%v at column %d", err, p.column())
+		}
+		return node, nil
+	}
+	return nil, fmt.Errorf("unexpected '%s' at column %d", token, p.column())
+}
+
+func (p *exprParser) call(name string) (exprNode, error) {
+	if isIndicator(name) {
+		return p.indicator(name)
+	}
+	fn, ok := exprFuncs[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown function '%s' at column %d", name, p.column())
+	}
+	p.next() // (
+
+	args := []exprNode{}
+	for {
+		arg, err := p.cond()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.peek() != "," {
+			break
+		}
+		p.next()
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+
+	if arity := exprFuncArity[strings.ToLower(name)]; len(args) != arity {
+		return nil, fmt.Errorf("%s takes %d argument(s)", name, arity)
+	}
+	return callNode{fn: fn, args: args}, nil
+}
+
+// indicator parses the periods of an indicator, e.g. "sma(200)" or "macd()"
+func (p *exprParser) indicator(name string) (exprNode, error) {
+	p.next() // (
+
+	params := []int{}
+	for p.peek() != ")" {
+		token := p.next()
+		period, err := strconv.Atoi(token)
+		if err != nil {
+			return nil, fmt.Errorf("%s periods must be whole numbers", name)
+		}
+		params = append(params, period)
+		if p.peek() == "," {
+			p.next()
+		} else if p.peek() != ")" {
+			break
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+
+	ind, err := newIndicator(name, params)
+	if err != nil {
+		return nil, err
+	}
+	return indicatorNode{ind: ind}, nil
+}
+
+// usesIndicators reports whether evaluating node needs the daily history
+func usesIndicators(node exprNode) bool {
+	switch n := node.(type) {
+	case indicatorNode:
+		return true
+	case unaryNode:
+		return usesIndicators(n.x)
+	case binaryNode:
+		return usesIndicators(n.l) || usesIndicators(n.r)
+	case callNode:
+		for _, arg := range n.args {
+			if usesIndicators(arg) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func newFieldNode(name string) (exprNode, error) {
+	fieldName := name
+	if alias, ok := exprAliases[name]; ok {
+		fieldName = alias
+	}
+
+	get, ok := quoteFields[fieldName]
+	if !ok {
+		return nil, fmt.Errorf("unknown field '%s'", name)
+	}
+	return fieldNode{name: name, get: get}, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var exprQuote = Quote{Ticker: "AAPL", LastTrade: 150, Change: -3, ChangePct: -2,
+	Low52: 100, High52: 200, Volume: 2000, AvgVolume: 1000}
+
+func evalExpr(t *testing.T, s string) float64 {
+	node, err := parseExpr(s)
+	require.NoError(t, err, s)
+	return node.eval(exprEnv{quote: exprQuote})
+}
+
+func TestExprEval(t *testing.T) {
+	for _, test := range []struct {
+		expr string
+		want float64
+	}{
+		// precedence
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 - 4 - 3", 3},
+		{"12 / 3 / 2", 2},
+		{"1 + 2 < 4", 1},
+		{"1 < 2 and 3 < 2", 0},
+		{"1 < 2 and 3 < 2 or 1", 1},
+		{"0 or 2 > 1 and 1", 1},
+
+		// unary minus
+		{"-2 * 3", -6},
+		{"--2", 2},
+		{"1 - -1", 2},
+		{"-(1 + 2)", -3},
+		{"-Change", 3},
+
+		// fields and aliases
+		{"Last", 150},
+		{"LastTrade", 150},
+		{"(Last - Low52)/(High52 - Low52)", 0.5},
+		{"Volume > AvgVolume", 1},
+		{"ChgPct < 0 AND Chg < 0", 1},
+
+		// functions
+		{"abs(Change)", 3},
+		{"min(1, 2) + max(1, 2)", 3},
+		{"sqrt(16)", 4},
+		{"max(1 < 2, 0)", 1},
+	} {
+		assert.Equal(t, test.want, evalExpr(t, test.expr), test.expr)
+	}
+}
+
+func TestExprMissingValues(t *testing.T) {
+	// division by zero and indicators without history have no value
+	assert.True(t, math.IsNaN(evalExpr(t, "1 / 0")))
+	assert.True(t, math.IsNaN(evalExpr(t, "Last / (Chg + 3)")))
+	assert.True(t, math.IsNaN(evalExpr(t, "sma(20)")))
+
+	// and are false in conditions
+	assert.False(t, truthy(evalExpr(t, "1 / 0")))
+	assert.Equal(t, 0.0, evalExpr(t, "1 / 0 or 0"))
+	assert.Equal(t, 0.0, evalExpr(t, "1 and sma(20)"))
+}
+
+func TestExprErrors(t *testing.T) {
+	for _, test := range []struct {
+		expr, err string
+	}{
+		{"", "empty expression"},
+		{"   ", "empty expression"},
+		{"Foo + 1", "unknown field 'Foo' at column 1"},
+		{"1 + last", "unknown field 'last' at column 5"},
+		{"foo(1)", "unknown function 'foo' at column 1"},
+		{"abs(1, 2)", "abs takes 1 argument(s)"},
+		{"1 +", "unexpected end of expression"},
+		{"(1 + 2", "expected ')' at end of expression"},
+		{"abs(1 2)", "expected ')' but found '2' at column 7"},
+		{"1 + 2)", "unexpected ')' at column 6"},
+		{"1 2", "unexpected '2' at column 3"},
+		{"1 + * 2", "unexpected '*' at column 5"},
+		{"Last = 1", "unexpected character '=' at column 6"},
+		{"Last $ 1", "unexpected character '$' at column 6"},
+		{"1.2.3", "invalid number '1.2.3' at column 1"},
+		{"sma(x)", "sma periods must be whole numbers"},
+		{"# and 1", "missing tag after '#' at column 1"},
+	} {
+		_, err := parseExpr(test.expr)
+		if assert.Error(t, err, test.expr) {
+			assert.Equal(t, test.err, err.Error(), test.expr)
+		}
+	}
+}
+
+func TestExprTags(t *testing.T) {
+	tags := func(ticker string) []string {
+		return map[string][]string{"AAPL": {"core", "tech"}}[ticker]
+	}
+	for _, test := range []struct {
+		expr string
+		want float64
+	}{
+		{"#core", 1},
+		{"#CORE", 1},
+		{"#energy", 0},
+		{"#core and ChgPct < 0", 1},
+		{"#energy or #tech", 1},
+		{"(#core)*2", 2},
+	} {
+		node, err := parseExpr(test.expr)
+		require.NoError(t, err, test.expr)
+		assert.Equal(t, test.want, node.eval(exprEnv{quote: exprQuote, tags: tags}),
+			test.expr)
+	}
+
+	// without tags, as for alerts, no ticker has any
+	assert.Equal(t, 0.0, evalExpr(t, "#core"))
+}
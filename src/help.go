@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nsf/termbox-go"
+)
+
+// helpEntry is a line of the help: an action and its keys, or a command
+type helpEntry struct {
+	keys string // keys of the action or the command, e.g. "j <Down>"
+	name string // name of the action, "" for commands
+	desc string
+}
+
+// helpView lists the key bindings and commands of the mode it was opened
+// from, as they are bound
+type helpView struct {
+	from      mode // mode described, which closing the help goes back to
+	keys      []helpEntry
+	commands  []helpEntry
+	options   []helpEntry
+	query     string // only entries containing all of its words are shown
+	searching bool   // the query is being typed
+	first     int    // first line shown
+}
+
+// lineEditorHelp describes the keys of the line editor as Handle reads them
+func lineEditorHelp() []helpEntry {
+	entries := []helpEntry{}
+	for _, act := range editorActions {
+		entries = append(entries, helpEntry{strings.Join(act.keys, " "), "", act.desc})
+	}
+	return entries
+}
+
+// OpenHelp shows the help of mode m over the screen
+func (ui *Ui) OpenHelp(m mode) {
+	ui.openHelp(m, "")
+}
+
+func (ui *Ui) openHelp(m mode, query string) {
+	help := &helpView{from: m, query: query}
+	if m == COMMAND {
+		help.keys = lineEditorHelp()
+	} else {
+		bound := ui.keymap.Keys(m)
+		for _, act := range ui.keymap.actions[m] {
+			help.keys = append(help.keys, helpEntry{
+				strings.Join(bound[act.name], " "), act.name, act.desc})
+		}
+	}
+
+	// the : commands, where they can be typed
+	if (m == COMMAND && ui.lineEditor.cmd == ':') ||
+		(m != COMMAND && len(ui.keymap.Keys(m)["command"]) > 0) {
+		help.commands = ui.lineEditor.commandHelp()
+		help.options = optionHelp()
+	}
+
+	ui.help = help
+	*ui.mode = HELP
+	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+	ui.Draw()
+}
+
+// closeHelp goes back to the mode the help was opened from
+func (ui *Ui) closeHelp() {
+	*ui.mode = ui.help.from
+	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+}
+
+// matches reports whether entry contains every word of the query
+func (help *helpView) matches(entry helpEntry) bool {
+	text := strings.ToLower(entry.keys + " " + entry.name + " " + entry.desc)
+	for _, word := range strings.Fields(strings.ToLower(help.query)) {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// lines returns the lines of the help matching the query, each section
+// under its title
+func (help *helpView) lines() []string {
+	title := "COMMAND"
+	if help.from != COMMAND {
+		title = strings.ToUpper(modeNames[help.from])
+	}
+
+	// the widest keys or command and two spaces
+	width := func(entries []helpEntry, min int) int {
+		for _, entry := range entries {
+			if len(entry.keys)+2 > min {
+				min = len(entry.keys) + 2
+			}
+		}
+		return min
+	}
+	keysWidth := width(help.keys, 14)
+	commandsWidth := width(help.options, width(help.commands, 32))
+
+	lines := []string{}
+	for _, section := range []struct {
+		title   string
+		entries []helpEntry
+	}{
+		{"Keys in " + title + " mode", help.keys},
+		{"Commands", help.commands},
+		{"Options of :set", help.options},
+	} {
+		matched := []string{}
+		for _, entry := range section.entries {
+			if !help.matches(entry) {
+				continue
+			}
+			if entry.name == "" {
+				matched = append(matched, fmt.Sprintf("  %-*v%v",
+					commandsWidth, entry.keys, entry.desc))
+			} else {
+				matched = append(matched, fmt.Sprintf("  %-*v%-18v%v",
+					keysWidth, entry.keys, entry.name, entry.desc))
+			}
+		}
+		if len(matched) > 0 {
+			if len(lines) > 0 {
+				lines = append(lines, "")
+			}
+			lines = append(lines, section.title)
+			lines = append(lines, matched...)
+		}
+	}
+	return lines
+}
+
+// Scroll moves the help by delta lines
+func (help *helpView) Scroll(delta int, win *Win) {
+	help.first += delta
+	if last := len(help.lines()) - (win.h - 1); help.first > last {
+		help.first = last
+	}
+	if help.first < 0 {
+		help.first = 0
+	}
+}
+
+// HandleSearch edits the query while it is being typed, the help is
+// filtered as it changes
+func (help *helpView) HandleSearch(ev termbox.Event) {
+	switch ev.Key {
+	case termbox.KeyEnter:
+		help.searching = false
+	case termbox.KeyEsc:
+		help.query = ""
+		help.searching = false
+	case termbox.KeyBackspace, termbox.KeyBackspace2:
+		if runes := []rune(help.query); len(runes) > 0 {
+			help.query = string(runes[:len(runes)-1])
+		}
+	case termbox.KeySpace:
+		help.query += " "
+	default:
+		if ev.Ch != 0 {
+			help.query += string(ev.Ch)
+		}
+	}
+	help.first = 0
+}
+
+func (help *helpView) Draw(win *Win, commandWin *Win) {
+	win.Clear()
+	win.print(0, 0, termbox.ColorDefault|termbox.AttrUnderline,
+		termbox.ColorDefault, fmt.Sprintf("%-*v", win.w,
+			"Help  j/k scroll  / search  q close"))
+
+	lines := help.lines()
+	for id := help.first; id < len(lines) && id-help.first < win.h-1; id++ {
+		fg := termbox.ColorDefault
+		if !strings.HasPrefix(lines[id], " ") {
+			fg |= termbox.AttrBold
+		}
+		win.print(0, id-help.first+1, fg, termbox.ColorDefault, lines[id])
+	}
+
+	commandWin.Clear()
+	if help.searching {
+		commandWin.print(0, 0, termbox.ColorDefault, termbox.ColorDefault,
+			"/"+help.query)
+		termbox.SetCursor(1+displayWidth(help.query), commandWin.y)
+		return
+	}
+	termbox.HideCursor()
+	if help.query != "" {
+		commandWin.print(0, 0, termbox.ColorDefault, termbox.ColorDefault,
+			fmt.Sprintf("matching '%s', / to change, <Esc> while typing to clear",
+				help.query))
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"sync"
+)
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// historyCache holds the price history of the tickers per range, refreshed
+// along with the quotes
+type historyCache struct {
+	lock   sync.Mutex
+	series map[string]map[string][]Candle // range -> ticker -> candles
+}
+
+func newHistoryCache() *historyCache {
+	return &historyCache{
+		series: map[string]map[string][]Candle{},
+	}
+}
+
+// Get returns the cached history of ticker over rng, nil if not fetched
+func (cache *historyCache) Get(ticker string, rng string) []Candle {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	return cache.series[rng][strings.ToUpper(ticker)]
+}
+
+// Has reports whether the history over rng has been fetched
+func (cache *historyCache) Has(rng string) bool {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	_, ok := cache.series[rng]
+	return ok
+}
+
+// Refresh fetches the history of tickers over rng, keeping the previous
+// history of the tickers that fail to fetch
+func (cache *historyCache) Refresh(tickers []string, rng string) error {
+	fetched, err := FetchHistories(tickers, rng)
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	if cache.series[rng] == nil {
+		cache.series[rng] = map[string][]Candle{}
+	}
+	for ticker, candles := range fetched {
+		cache.series[rng][strings.ToUpper(ticker)] = candles
+	}
+	return err
+}
+
+func closes(candles []Candle) []float64 {
+	values := make([]float64, len(candles))
+	for id, c := range candles {
+		values[id] = c.Close
+	}
+	return values
+}
+
+// resample picks n evenly spaced values, keeping the first and the last, or
+// only the last if n is 1
+func resample(values []float64, n int) []float64 {
+	if len(values) <= n {
+		return values
+	}
+	if n < 1 {
+		return nil
+	}
+	if n == 1 {
+		return values[len(values)-1:]
+	}
+	result := make([]float64, n)
+	for i := range result {
+		result[i] = values[i*(len(values)-1)/(n-1)]
+	}
+	return result
+}
+
+// sparkline draws values as a line of block characters at most width wide
+func sparkline(values []float64, width int) string {
+	values = resample(values, width)
+	if len(values) == 0 {
+		return ""
+	}
+
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		low = math.Min(low, v)
+		high = math.Max(high, v)
+	}
+
+	line := make([]rune, len(values))
+	for id, v := range values {
+		level := len(sparkBlocks) / 2
+		if high > low {
+			level = int((v - low) / (high - low) * float64(len(sparkBlocks)-1))
+		}
+		line[id] = sparkBlocks[level]
+	}
+	return string(line)
+}
+
+// seriesChange is the change in percent from the first to the last value
+func seriesChange(values []float64) float64 {
+	if len(values) < 2 || values[0] == 0 {
+		return math.NaN()
+	}
+	return (values[len(values)-1] - values[0]) / values[0] * 100
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResample(t *testing.T) {
+	values := []float64{1, 2, 3, 4, 5, 6, 7}
+	assert.Equal(t, []float64{1, 4, 7}, resample(values, 3))
+	assert.Equal(t, []float64{7}, resample(values, 1))
+	assert.Empty(t, resample(values, 0))
+	assert.Empty(t, resample(values, -1))
+	assert.Equal(t, values, resample(values, 10))
+}
+
+func TestSparklineFitsItsWidth(t *testing.T) {
+	values := []float64{1, 3, 2, 5, 4, 6, 8, 7}
+	for width := -1; width <= 10; width++ {
+		line := sparkline(values, width)
+		want := width
+		if want < 0 {
+			want = 0
+		}
+		if want > len(values) {
+			want = len(values)
+		}
+		assert.Equal(t, want, utf8.RuneCountInString(line), "width %d", width)
+	}
+	assert.Equal(t, "▁▃▂▅▄▆█▇", sparkline(values, 8))
+}
+
+func TestFormatSparklineLeavesAGap(t *testing.T) {
+	values := []float64{1, 3, 2, 5, 4, 6, 8, 7}
+	for width, want := range []int{0, 0, 1, 2, 3} {
+		col := &Column{width: width}
+		assert.Equal(t, want, utf8.RuneCountInString(formatSparkline(col, values)),
+			"width %d", width)
+	}
+}
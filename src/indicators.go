@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type indicatorKind string
+
+const (
+	IND_SMA  indicatorKind = "sma"  // simple moving average of the close
+	IND_EMA  indicatorKind = "ema"  // exponential moving average of the close
+	IND_RSI  indicatorKind = "rsi"  // relative strength index, 0-100
+	IND_MACD indicatorKind = "macd" // MACD histogram, above 0 is bullish
+	IND_ATR  indicatorKind = "atr"  // average true range
+)
+
+// daily history the indicators are computed from, long enough for a
+// 200-day average
+const indicatorRange = "1y"
+
+// default and allowed number of parameters of each indicator
+var indicatorParams = map[indicatorKind][]int{
+	IND_SMA:  {50},
+	IND_EMA:  {20},
+	IND_RSI:  {14},
+	IND_MACD: {12, 26, 9},
+	IND_ATR:  {14},
+}
+
+// indicator is an indicator with its periods, e.g. rsi(14)
+type indicator struct {
+	kind   indicatorKind
+	params []int
+}
+
+func isIndicator(name string) bool {
+	_, ok := indicatorParams[indicatorKind(strings.ToLower(name))]
+	return ok
+}
+
+func newIndicator(name string, params []int) (indicator, error) {
+	kind := indicatorKind(strings.ToLower(name))
+	defaults, ok := indicatorParams[kind]
+	if !ok {
+		return indicator{}, fmt.Errorf("unknown indicator '%s'", name)
+	}
+	if len(params) == 0 {
+		params = defaults
+	}
+	if len(params) != len(defaults) {
+		return indicator{}, fmt.Errorf("%s takes %d period(s)", kind, len(defaults))
+	}
+	for _, p := range params {
+		if p < 1 || p > 250 {
+			return indicator{}, fmt.Errorf("%s period must be between 1 and 250", kind)
+		}
+	}
+	return indicator{kind: kind, params: params}, nil
+}
+
+// parseIndicator parses an indicator such as "sma(20)" or "macd"
+func parseIndicator(s string) (indicator, error) {
+	s = strings.TrimSpace(s)
+	name, args := s, ""
+	if open := strings.Index(s, "("); open >= 0 {
+		if !strings.HasSuffix(s, ")") {
+			return indicator{}, fmt.Errorf("missing ')' in '%s'", s)
+		}
+		name, args = s[:open], s[open+1:len(s)-1]
+	}
+
+	params := []int{}
+	for _, arg := range strings.Split(args, ",") {
+		if strings.TrimSpace(arg) == "" {
+			continue
+		}
+		p, err := strconv.Atoi(strings.TrimSpace(arg))
+		if err != nil {
+			return indicator{}, fmt.Errorf("invalid period '%s'", arg)
+		}
+		params = append(params, p)
+	}
+	return newIndicator(name, params)
+}
+
+func (ind indicator) String() string {
+	params := make([]string, len(ind.params))
+	for id, p := range ind.params {
+		params[id] = strconv.Itoa(p)
+	}
+	return fmt.Sprintf("%s(%s)", ind.kind, strings.Join(params, ","))
+}
+
+// overlay reports whether the indicator is on the price scale and can be
+// drawn over a price chart
+func (ind indicator) overlay() bool {
+	return ind.kind == IND_SMA || ind.kind == IND_EMA
+}
+
+// series computes the indicator for every candle, NaN where there isn't
+// enough history yet
+func (ind indicator) series(candles []Candle) []float64 {
+	switch ind.kind {
+	case IND_SMA:
+		return movingAverage(closes(candles), ind.params[0])
+	case IND_EMA:
+		return expMovingAverage(closes(candles), ind.params[0])
+	case IND_RSI:
+		return relativeStrength(closes(candles), ind.params[0])
+	case IND_MACD:
+		_, _, histogram := macd(closes(candles), ind.params[0], ind.params[1],
+			ind.params[2])
+		return histogram
+	case IND_ATR:
+		return averageTrueRange(candles, ind.params[0])
+	}
+	return nil
+}
+
+func nanSeries(n int) []float64 {
+	result := make([]float64, n)
+	for i := range result {
+		result[i] = math.NaN()
+	}
+	return result
+}
+
+// movingAverage is the simple moving average of values, NaN until there are
+// enough values
+func movingAverage(values []float64, period int) []float64 {
+	result := make([]float64, len(values))
+	sum := 0.0
+	for i, v := range values {
+		sum += v
+		if i >= period {
+			sum -= values[i-period]
+		}
+		if i < period-1 {
+			result[i] = math.NaN()
+		} else {
+			result[i] = sum / float64(period)
+		}
+	}
+	return result
+}
+
+// expMovingAverage is the exponential moving average of values, seeded with
+// the simple average of the first period values. Leading NaNs are skipped.
+func expMovingAverage(values []float64, period int) []float64 {
+	result := nanSeries(len(values))
+	k := 2 / float64(period+1)
+
+	start := 0
+	for start < len(values) && math.IsNaN(values[start]) {
+		start++
+	}
+	if len(values)-start < period {
+		return result
+	}
+
+	sum := 0.0
+	for _, v := range values[start : start+period] {
+		sum += v
+	}
+	ema := sum / float64(period)
+	result[start+period-1] = ema
+	for i := start + period; i < len(values); i++ {
+		ema = values[i]*k + ema*(1-k)
+		result[i] = ema
+	}
+	return result
+}
+
+// relativeStrength is Wilder's RSI of values
+func relativeStrength(values []float64, period int) []float64 {
+	result := nanSeries(len(values))
+	if len(values) <= period {
+		return result
+	}
+
+	gain, loss := 0.0, 0.0
+	for i := 1; i <= period; i++ {
+		change := values[i] - values[i-1]
+		gain += math.Max(change, 0)
+		loss += math.Max(-change, 0)
+	}
+	gain /= float64(period)
+	loss /= float64(period)
+
+	rsi := func() float64 {
+		if loss == 0 {
+			return 100
+		}
+		return 100 - 100/(1+gain/loss)
+	}
+	result[period] = rsi()
+	for i := period + 1; i < len(values); i++ {
+		change := values[i] - values[i-1]
+		gain = (gain*float64(period-1) + math.Max(change, 0)) / float64(period)
+		loss = (loss*float64(period-1) + math.Max(-change, 0)) / float64(period)
+		result[i] = rsi()
+	}
+	return result
+}
+
+// macd returns the MACD line, its signal line and their difference
+func macd(values []float64, fast, slow, signal int) ([]float64, []float64,
+	[]float64) {
+
+	fastEMA := expMovingAverage(values, fast)
+	slowEMA := expMovingAverage(values, slow)
+	line := make([]float64, len(values))
+	for i := range values {
+		line[i] = fastEMA[i] - slowEMA[i]
+	}
+	signalLine := expMovingAverage(line, signal)
+	histogram := make([]float64, len(values))
+	for i := range values {
+		histogram[i] = line[i] - signalLine[i]
+	}
+	return line, signalLine, histogram
+}
+
+// averageTrueRange is Wilder's ATR of the candles
+func averageTrueRange(candles []Candle, period int) []float64 {
+	result := nanSeries(len(candles))
+	if len(candles) <= period {
+		return result
+	}
+
+	trueRange := func(i int) float64 {
+		c, prev := candles[i], candles[i-1].Close
+		return math.Max(c.High-c.Low, math.Max(math.Abs(c.High-prev),
+			math.Abs(c.Low-prev)))
+	}
+
+	atr := 0.0
+	for i := 1; i <= period; i++ {
+		atr += trueRange(i)
+	}
+	atr /= float64(period)
+	result[period] = atr
+	for i := period + 1; i < len(candles); i++ {
+		atr = (atr*float64(period-1) + trueRange(i)) / float64(period)
+		result[i] = atr
+	}
+	return result
+}
+
+// indicatorCache holds the latest value of each indicator per ticker,
+// computed on first use from the daily history and reset on every refresh
+type indicatorCache struct {
+	history *historyCache
+	lock    sync.Mutex
+	values  map[string]float64
+}
+
+func newIndicatorCache(history *historyCache) *indicatorCache {
+	return &indicatorCache{
+		history: history,
+		values:  map[string]float64{},
+	}
+}
+
+// Value returns the latest value of ind for ticker, NaN when there isn't
+// enough history
+func (cache *indicatorCache) Value(ticker string, ind indicator) float64 {
+	key := strings.ToUpper(ticker) + " " + ind.String()
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	if v, ok := cache.values[key]; ok {
+		return v
+	}
+
+	v := math.NaN()
+	if series := ind.series(cache.history.Get(ticker, indicatorRange)); len(series) > 0 {
+		v = series[len(series)-1]
+	}
+	cache.values[key] = v
+	return v
+}
+
+func (cache *indicatorCache) Reset() {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	cache.values = map[string]float64{}
+}
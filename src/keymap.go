@@ -0,0 +1,541 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nsf/termbox-go"
+)
+
+// action is something a key sequence can be bound to in one mode
+type action struct {
+	name string
+	desc string   // shown in the help
+	keys []string // default key sequences, e.g. "j", "<Down>", "gg"
+	run  func(app *app)
+}
+
+// names of the modes in the Keymap section of the profile
+var modeNames = map[mode]string{
+	NORMAL:  "normal",
+	SORT:    "sort",
+	VISUAL:  "visual",
+	ALERTS:  "alerts",
+	COLUMNS: "columns",
+	CHART:   "chart",
+	COMPARE: "compare",
+	HELP:    "help",
+}
+
+// names of the special keys, a sequence such as "g<Down>" mixes them with
+// plain characters
+var keyNames = map[termbox.Key]string{
+	termbox.KeyEnter:      "<Enter>",
+	termbox.KeyEsc:        "<Esc>",
+	termbox.KeySpace:      "<Space>",
+	termbox.KeyTab:        "<Tab>",
+	termbox.KeyBackspace2: "<BS>",
+	termbox.KeyArrowUp:    "<Up>",
+	termbox.KeyArrowDown:  "<Down>",
+	termbox.KeyArrowLeft:  "<Left>",
+	termbox.KeyArrowRight: "<Right>",
+	termbox.KeyPgup:       "<PgUp>",
+	termbox.KeyPgdn:       "<PgDn>",
+	termbox.KeyHome:       "<Home>",
+	termbox.KeyEnd:        "<End>",
+	termbox.KeyDelete:     "<Del>",
+}
+
+func init() {
+	// control keys that don't double as one of the keys above, e.g. <C-d>
+	for k := termbox.KeyCtrlA; k <= termbox.KeyCtrlZ; k++ {
+		if _, ok := keyNames[k]; !ok {
+			keyNames[k] = fmt.Sprintf("<C-%c>", 'a'+rune(k-termbox.KeyCtrlA))
+		}
+	}
+}
+
+// eventKey is the name of the key pressed, "" for keys that can't be bound
+func eventKey(ev termbox.Event) string {
+	if ev.Ch != 0 {
+		if ev.Ch == ' ' {
+			return "<Space>"
+		}
+		return string(ev.Ch)
+	}
+	return keyNames[ev.Key]
+}
+
+// parseKeys splits a key sequence into keys: "<...>" is a special key when
+// it names one, any other character is a key of its own
+func parseKeys(s string) ([]string, error) {
+	special := map[string]string{}
+	for _, name := range keyNames {
+		special[strings.ToLower(name)] = name
+	}
+
+	keys := []string{}
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == '<' {
+			end := i + 1
+			for end < len(runes) && runes[end] != '>' {
+				end++
+			}
+			if end < len(runes) {
+				if key, ok := special[strings.ToLower(string(runes[i:end+1]))]; ok {
+					keys = append(keys, key)
+					i = end
+					continue
+				}
+			}
+		}
+		if runes[i] == ' ' {
+			keys = append(keys, "<Space>")
+			continue
+		}
+		keys = append(keys, string(runes[i]))
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("empty key sequence")
+	}
+	return keys, nil
+}
+
+// modes in which a number typed before a key is a count, e.g. 5j
+var countModes = map[mode]bool{
+	NORMAL: true,
+	VISUAL: true,
+}
+
+// largest count, more digits are ignored
+const maxCount = 99999
+
+// keymap maps the key sequences of each mode to their actions
+type keymap struct {
+	actions  map[mode][]action           // actions of each mode in the order of the help
+	bindings map[mode]map[string]*action // mode -> keys joined by " " -> action
+	pending  []string                    // keys of a sequence typed so far
+	count    int                         // count typed so far, 0 for none
+}
+
+// newKeymap binds the default keys of every action, then applies the
+// overrides of the profile, e.g. {"normal": {"dd": "delete", "d": "none"}}.
+// An override replaces the default bindings it conflicts with; overrides
+// that are invalid or conflict with each other are dropped and returned as
+// errors.
+func newKeymap(actions map[mode][]action,
+	overrides map[string]map[string]string) (*keymap, []error) {
+
+	km := &keymap{actions: actions, bindings: map[mode]map[string]*action{}}
+	for m, list := range actions {
+		km.bindings[m] = map[string]*action{}
+		for id := range list {
+			for _, keys := range list[id].keys {
+				parsed, _ := parseKeys(keys)
+				km.bindings[m][strings.Join(parsed, " ")] = &list[id]
+			}
+		}
+	}
+
+	errs := []error{}
+	byName := map[string]mode{}
+	for m, name := range modeNames {
+		byName[name] = m
+	}
+
+	modes := make([]string, 0, len(overrides))
+	for name := range overrides {
+		modes = append(modes, name)
+	}
+	sort.Strings(modes)
+	for _, modeName := range modes {
+		m, ok := byName[strings.ToLower(modeName)]
+		if !ok {
+			errs = append(errs, fmt.Errorf("keymap: unknown mode '%s'", modeName))
+			continue
+		}
+
+		sequences := make([]string, 0, len(overrides[modeName]))
+		for keys := range overrides[modeName] {
+			sequences = append(sequences, keys)
+		}
+		sort.Strings(sequences)
+
+		user := map[string]bool{}
+		for _, keys := range sequences {
+			name := overrides[modeName][keys]
+			parsed, err := parseKeys(keys)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("keymap: %s: %v", modeName, err))
+				continue
+			}
+			seq := strings.Join(parsed, " ")
+
+			if name == "" || name == "none" {
+				delete(km.bindings[m], seq)
+				continue
+			}
+			act := findAction(actions[m], name)
+			if act == nil {
+				errs = append(errs, fmt.Errorf("keymap: no action '%s' in %s mode",
+					name, modeName))
+				continue
+			}
+
+			conflict := ""
+			for other := range km.bindings[m] {
+				if other == seq || !isPrefix(other, seq) && !isPrefix(seq, other) {
+					continue
+				}
+				if user[other] {
+					conflict = other
+					break
+				}
+			}
+			if conflict != "" {
+				errs = append(errs, fmt.Errorf("keymap: '%s' conflicts with '%s' in %s mode",
+					keys, strings.Replace(conflict, " ", "", -1), modeName))
+				continue
+			}
+
+			// the defaults that would shadow or be shadowed by the override
+			for other := range km.bindings[m] {
+				if isPrefix(other, seq) || isPrefix(seq, other) {
+					delete(km.bindings[m], other)
+				}
+			}
+			km.bindings[m][seq] = act
+			user[seq] = true
+		}
+	}
+	return km, errs
+}
+
+func findAction(list []action, name string) *action {
+	for id := range list {
+		if list[id].name == name {
+			return &list[id]
+		}
+	}
+	return nil
+}
+
+// isPrefix reports whether the key sequence prefix starts seq
+func isPrefix(prefix, seq string) bool {
+	return seq == prefix || strings.HasPrefix(seq, prefix+" ")
+}
+
+// Press adds a key to the pending sequence and returns the action it
+// completes along with the count typed before it, 0 if none. The action is
+// nil while a count or a longer sequence is being typed or if no sequence
+// matches.
+func (km *keymap) Press(m mode, key string) (*action, int) {
+	if key == "" {
+		km.Reset()
+		return nil, 0
+	}
+
+	// digits start a count, 0 continues one but is a key of its own first
+	if countModes[m] && len(km.pending) == 0 && len(key) == 1 &&
+		key[0] >= '0' && key[0] <= '9' && (key != "0" || km.count > 0) {
+		if km.count*10+int(key[0]-'0') <= maxCount {
+			km.count = km.count*10 + int(key[0]-'0')
+		}
+		return nil, 0
+	}
+
+	km.pending = append(km.pending, key)
+	seq := strings.Join(km.pending, " ")
+
+	if act, ok := km.bindings[m][seq]; ok {
+		count := km.count
+		km.Reset()
+		return act, count
+	}
+	for other := range km.bindings[m] {
+		if isPrefix(seq, other) {
+			return nil, 0
+		}
+	}
+
+	// not a sequence: start over with the last key on its own
+	km.Reset()
+	if len(strings.Fields(seq)) > 1 {
+		return km.Press(m, key)
+	}
+	return nil, 0
+}
+
+// Reset drops the count and the keys typed so far
+func (km *keymap) Reset() {
+	km.pending = nil
+	km.count = 0
+}
+
+// Pending returns the count and keys typed so far, e.g. "5z"
+func (km *keymap) Pending() string {
+	s := strings.Join(km.pending, "")
+	if km.count > 0 {
+		s = strconv.Itoa(km.count) + s
+	}
+	return s
+}
+
+// Keys returns the key sequences bound to each action of mode, by action
+func (km *keymap) Keys(m mode) map[string][]string {
+	keys := map[string][]string{}
+	for seq, act := range km.bindings[m] {
+		keys[act.name] = append(keys[act.name], strings.Replace(seq, " ", "", -1))
+	}
+	// plain keys first, e.g. "j <Down>"
+	for name := range keys {
+		seqs := keys[name]
+		sort.Slice(seqs, func(i, j int) bool {
+			if len(seqs[i]) != len(seqs[j]) {
+				return len(seqs[i]) < len(seqs[j])
+			}
+			return seqs[i] < seqs[j]
+		})
+	}
+	return keys
+}
+
+// countOr returns the count typed before the key of the running action, or
+// n if there was none
+func (app *app) countOr(n int) int {
+	if app.count > 0 {
+		return app.count
+	}
+	return n
+}
+
+// gotoRow selects row count with a count, or row n otherwise, e.g. for 10G
+func (app *app) gotoRow(n int) {
+	if app.count > 0 {
+		app.ui.selectQuote(app.count - 1)
+	} else {
+		app.ui.selectQuote(n)
+	}
+}
+
+// listActions are the motions shared by NORMAL and VISUAL mode
+func listActions() []action {
+	half := func(app *app) int { return app.countOr(1) * (app.ui.stockWin.h + 1) / 2 }
+	page := func(app *app) int { return app.countOr(1) * app.ui.stockWin.h }
+	return []action{
+		{"down", "select the next row", []string{"j", "<Down>"}, func(app *app) { app.ui.navigateStockBy(app.countOr(1)) }},
+		{"up", "select the previous row", []string{"k", "<Up>"}, func(app *app) { app.ui.navigateStockBy(-app.countOr(1)) }},
+		{"top", "go to the first row, or row N with a count", []string{"gg"}, func(app *app) { app.gotoRow(0) }},
+		{"bottom", "go to the last row, or row N with a count", []string{"G"}, func(app *app) { app.gotoRow(len(*app.ui.stockQuotes) - 1) }},
+		{"half-page-down", "scroll half a screen down", []string{"<C-d>"}, func(app *app) { app.ui.pageStocks(half(app)) }},
+		{"half-page-up", "scroll half a screen up", []string{"<C-u>"}, func(app *app) { app.ui.pageStocks(-half(app)) }},
+		{"page-down", "scroll a screen down", []string{"<C-f>", "<PgDn>"}, func(app *app) { app.ui.pageStocks(page(app)) }},
+		{"page-up", "scroll a screen up", []string{"<C-b>", "<PgUp>"}, func(app *app) { app.ui.pageStocks(-page(app)) }},
+		{"screen-top", "select the top row of the screen", []string{"H"}, func(app *app) { app.ui.selectScreenRow('H', app.countOr(1)) }},
+		{"screen-middle", "select the middle row of the screen", []string{"M"}, func(app *app) { app.ui.selectScreenRow('M', 1) }},
+		{"screen-bottom", "select the bottom row of the screen", []string{"L"}, func(app *app) { app.ui.selectScreenRow('L', app.countOr(1)) }},
+		{"scroll-center", "scroll the selected row to the middle", []string{"zz"}, func(app *app) { app.ui.scrollSelectionTo('z') }},
+		{"scroll-top", "scroll the selected row to the top", []string{"zt"}, func(app *app) { app.ui.scrollSelectionTo('t') }},
+		{"scroll-bottom", "scroll the selected row to the bottom", []string{"zb"}, func(app *app) { app.ui.scrollSelectionTo('b') }},
+		{"next-match", "go to the next match of the search", []string{"n"}, func(app *app) { app.ui.searchNext(app.countOr(1), false) }},
+		{"previous-match", "go to the previous match of the search", []string{"N"}, func(app *app) { app.ui.searchNext(app.countOr(1), true) }},
+		{"search-ticker", "search for the selected ticker", []string{"*"}, func(app *app) { app.ui.searchWord(app.countOr(1)) }},
+	}
+}
+
+// prompt switches to COMMAND mode with the prompt of cmd
+func (app *app) prompt(cmd rune) {
+	app.ui.Prompt(cmd)
+	*app.mode = COMMAND
+}
+
+func (app *app) quit() {
+	app.stop(true)
+}
+
+// quitWithoutSaving quits leaving the profile file as it was, as q does in
+// SORT mode
+func (app *app) quitWithoutSaving() {
+	app.stop(false)
+}
+
+func (app *app) stop(save bool) {
+	select {
+	case app.quitChan <- save:
+	default:
+	}
+}
+
+// back leaves a full screen view for the list
+func (app *app) back() {
+	*app.mode = NORMAL
+	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+}
+
+func (app *app) openInBrowser() {
+	if !app.allowOpenInBrowser {
+		return
+	}
+	app.ui.OpenInBrowser()
+
+	// Debounce the action
+	app.allowOpenInBrowser = false
+	time.AfterFunc(app.debounceDuration, func() {
+		app.allowOpenInBrowser = true
+	})
+}
+
+// sortAction returns an action handing key to the SORT mode handler
+func sortAction(name, desc string, key rune, keys ...string) action {
+	return action{name, desc, keys, func(app *app) { app.ui.HandleSortEvent(key) }}
+}
+
+// newActions registers the actions of every mode along with their default
+// keys
+func newActions() map[mode][]action {
+	actions := map[mode][]action{
+		NORMAL: {
+			{"quit", "quit monmop", []string{"q", "Q"}, (*app).quit},
+			{"scroll-right", "scroll the columns right", []string{"l", "<Right>"}, func(app *app) { app.ui.scrollColumnsRight() }},
+			{"scroll-left", "scroll the columns left", []string{"h", "<Left>"}, func(app *app) { app.ui.scrollColumnsLeft() }},
+			{"scroll-start", "scroll to the first columns", []string{"0"}, func(app *app) { app.ui.scrollColumnsStart() }},
+			{"scroll-end", "scroll to the last columns", []string{"$"}, func(app *app) { app.ui.scrollColumnsEnd() }},
+			{"move-down", "move the ticker down in the portfolio", []string{"J"}, func(app *app) { app.ui.moveSelected(app.countOr(1)) }},
+			{"move-up", "move the ticker up in the portfolio", []string{"K"}, func(app *app) { app.ui.moveSelected(-app.countOr(1)) }},
+			{"visual", "select a range of tickers", []string{"V"}, func(app *app) { app.ui.startVisual() }},
+			{"chart", "chart the selected ticker", []string{"c"}, func(app *app) { app.ui.OpenChart() }},
+			{"refresh", "fetch the quotes now", []string{"r"}, (*app).fetchAndDraw},
+			{"sort", "sort by a column", []string{"s"}, func(app *app) { *app.mode = SORT }},
+			{"add", "add tickers", []string{"a"}, func(app *app) { app.prompt('a') }},
+			{"delete", "delete the selected ticker", []string{"d"}, func(app *app) { app.prompt('d') }},
+			{"tag", "tag the selected ticker", []string{"t"}, func(app *app) { app.prompt('t') }},
+			{"command", "enter a command", []string{":"}, func(app *app) { app.prompt(':') }},
+			{"search", "search tickers, names, notes and tags", []string{"/"}, func(app *app) { app.prompt('/') }},
+			{"open", "open the ticker on Yahoo Finance", []string{"o", "<Enter>"}, (*app).openInBrowser},
+		},
+		SORT: {
+			{"quit", "quit monmop without saving", []string{"q", "Q"}, (*app).quitWithoutSaving},
+			{"back", "leave sort mode", []string{"<Esc>"}, func(app *app) { *app.mode = NORMAL }},
+			sortAction("left", "select the column to the left", 'h', "h", "b", "<Left>"),
+			sortAction("right", "select the column to the right", 'l', "l", "e", "<Right>"),
+			sortAction("first", "select the first column", '0', "0"),
+			sortAction("last", "select the last column", '$', "$"),
+			sortAction("descending", "sort by the column, largest first", 'j', "j", "<Down>"),
+			sortAction("ascending", "sort by the column, smallest first", 'k', "k", "<Up>"),
+			sortAction("then-descending", "then by the column, largest first", 'J', "J"),
+			sortAction("then-ascending", "then by the column, smallest first", 'K', "K"),
+			sortAction("unsort", "take the column out of the sort", 'x', "x"),
+			sortAction("manual", "back to the manual order", 'm', "m"),
+		},
+		VISUAL: {
+			{"back", "leave visual mode", []string{"q", "V", "<Esc>"}, func(app *app) { app.ui.stopVisual() }},
+			{"move-down", "move the tickers down in the portfolio", []string{"J"}, func(app *app) { app.ui.moveSelection(app.countOr(1)) }},
+			{"move-up", "move the tickers up in the portfolio", []string{"K"}, func(app *app) { app.ui.moveSelection(-app.countOr(1)) }},
+			{"compare", "compare the tickers on one chart", []string{"c"}, func(app *app) {
+				tickers := app.ui.selectionTickers()
+				app.ui.stopVisual()
+				app.ui.OpenCompare(tickers)
+			}},
+			// delete, tag, yank to a portfolio and export
+			{"delete", "delete the tickers", []string{"d"}, func(app *app) { app.promptSelection('d') }},
+			{"tag", "tag or untag the tickers", []string{"t"}, func(app *app) { app.promptSelection('t') }},
+			{"copy", "copy the tickers to a portfolio", []string{"y"}, func(app *app) { app.promptSelection('y') }},
+			{"export", "export the tickers to a CSV file", []string{"e"}, func(app *app) { app.promptSelection('e') }},
+		},
+		ALERTS: {
+			{"back", "back to the list", []string{"q", "<Esc>"}, (*app).back},
+			{"down", "select the next rule", []string{"j", "<Down>"}, func(app *app) { app.ui.navigateAlertDown() }},
+			{"up", "select the previous rule", []string{"k", "<Up>"}, func(app *app) { app.ui.navigateAlertUp() }},
+			{"acknowledge", "acknowledge the alert", []string{"a"}, func(app *app) { app.ui.acknowledgeAlert() }},
+			{"delete", "delete the rule", []string{"d"}, func(app *app) { app.ui.deleteAlert() }},
+			{"edit", "edit the rule", []string{"e"}, func(app *app) {
+				app.ui.PromptAlert(true)
+				*app.mode = COMMAND
+			}},
+			{"new", "add a rule", []string{"n"}, func(app *app) {
+				app.ui.PromptAlert(false)
+				*app.mode = COMMAND
+			}},
+		},
+		COLUMNS: {
+			{"back", "back to the list", []string{"q", "<Esc>"}, (*app).back},
+			{"down", "select the next column", []string{"j", "<Down>"}, func(app *app) { app.ui.navigateColumnDown() }},
+			{"up", "select the previous column", []string{"k", "<Up>"}, func(app *app) { app.ui.navigateColumnUp() }},
+			{"toggle", "show or hide the column", []string{"x", "<Space>"}, func(app *app) { app.ui.toggleColumn() }},
+			{"move-down", "move the column down", []string{"J"}, func(app *app) { app.ui.moveColumn(1) }},
+			{"move-up", "move the column up", []string{"K"}, func(app *app) { app.ui.moveColumn(-1) }},
+			{"wider", "make the column wider", []string{">", "+"}, func(app *app) { app.ui.resizeColumn(1) }},
+			{"narrower", "make the column narrower", []string{"<", "-"}, func(app *app) { app.ui.resizeColumn(-1) }},
+		},
+		CHART: {
+			{"back", "back to the list", []string{"q", "<Esc>"}, (*app).back},
+			{"left", "move the crosshair left", []string{"h", "<Left>"}, func(app *app) { app.ui.chart.MoveCursor(-1) }},
+			{"right", "move the crosshair right", []string{"l", "<Right>"}, func(app *app) { app.ui.chart.MoveCursor(1) }},
+			{"first", "move the crosshair to the first bar", []string{"H", "0"}, func(app *app) { app.ui.chart.MoveCursorTo(false) }},
+			{"last", "move the crosshair to the last bar", []string{"L", "$"}, func(app *app) { app.ui.chart.MoveCursorTo(true) }},
+			{"style", "switch between candlesticks and a line", []string{"c"}, func(app *app) { app.ui.chart.ToggleStyle() }},
+			{"overlays", "show or hide the overlays", []string{"m"}, func(app *app) { app.ui.chart.ToggleAverages() }},
+			{"pane", "switch the lower pane", []string{"i"}, func(app *app) { app.ui.chart.CyclePane() }},
+		},
+		COMPARE: {
+			{"back", "back to the list", []string{"q", "<Esc>"}, (*app).back},
+			{"left", "move the crosshair left", []string{"h", "<Left>"}, func(app *app) { app.ui.compare.MoveCursor(-1) }},
+			{"right", "move the crosshair right", []string{"l", "<Right>"}, func(app *app) { app.ui.compare.MoveCursor(1) }},
+			{"first", "move the crosshair to the first date", []string{"H", "0"}, func(app *app) { app.ui.compare.MoveCursorTo(false) }},
+			{"last", "move the crosshair to the last date", []string{"L", "$"}, func(app *app) { app.ui.compare.MoveCursorTo(true) }},
+		},
+	}
+
+	actions[NORMAL] = append(actions[NORMAL], listActions()...)
+	actions[VISUAL] = append(actions[VISUAL], listActions()...)
+
+	// the number keys select the ranges of both charts
+	for id, r := range chartRanges {
+		id := id
+		key := strconv.Itoa(id + 1)
+		actions[CHART] = append(actions[CHART], action{"range-" + r.label,
+			"show " + r.label, []string{key}, func(app *app) { app.ui.chart.SetRange(id, app.ui.history) }})
+		actions[COMPARE] = append(actions[COMPARE], action{"range-" + r.label,
+			"show " + r.label, []string{key}, func(app *app) { app.ui.compare.SetRange(id, app.ui.history) }})
+	}
+
+	// ? shows the help of the mode it is pressed in
+	for m := range actions {
+		m := m
+		actions[m] = append(actions[m], action{"help", "show this help",
+			[]string{"?"}, func(app *app) { app.ui.OpenHelp(m) }})
+	}
+
+	scroll := func(app *app, delta int) { app.ui.help.Scroll(delta, app.ui.chartWin()) }
+	actions[HELP] = []action{
+		{"back", "close the help", []string{"q", "?", "<Esc>"}, func(app *app) { app.ui.closeHelp() }},
+		{"down", "scroll down", []string{"j", "<Down>"}, func(app *app) { scroll(app, app.countOr(1)) }},
+		{"up", "scroll up", []string{"k", "<Up>"}, func(app *app) { scroll(app, -app.countOr(1)) }},
+		{"page-down", "scroll a screen down", []string{"<C-f>", "<PgDn>", "<Space>"}, func(app *app) {
+			scroll(app, app.ui.chartWin().h-1)
+		}},
+		{"page-up", "scroll a screen up", []string{"<C-b>", "<PgUp>"}, func(app *app) {
+			scroll(app, 1-app.ui.chartWin().h)
+		}},
+		{"top", "scroll to the top", []string{"gg"}, func(app *app) { app.ui.help.first = 0 }},
+		{"bottom", "scroll to the bottom", []string{"G"}, func(app *app) {
+			scroll(app, len(app.ui.help.lines()))
+		}},
+		{"search", "show only the lines containing some words", []string{"/"}, func(app *app) {
+			app.ui.help.searching = true
+			app.ui.help.query = ""
+		}},
+	}
+	return actions
+}
+
+// promptSelection switches to COMMAND mode with the prompt of cmd acting on
+// the VISUAL selection
+func (app *app) promptSelection(cmd rune) {
+	app.ui.PromptSelection(cmd)
+	*app.mode = COMMAND
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultTopIsGG(t *testing.T) {
+	km, errs := newKeymap(newActions(), nil)
+	require.Empty(t, errs)
+	for _, m := range []mode{NORMAL, VISUAL, HELP} {
+		if assert.Contains(t, km.bindings[m], "g g", modeNames[m]) {
+			assert.Equal(t, "top", km.bindings[m]["g g"].name, modeNames[m])
+		}
+		// g alone is left as the start of sequences
+		assert.NotContains(t, km.bindings[m], "g", modeNames[m])
+	}
+}
+
+func TestQuitSavesExceptInSortMode(t *testing.T) {
+	km, _ := newKeymap(newActions(), nil)
+	for _, test := range []struct {
+		m    mode
+		save bool
+	}{
+		{NORMAL, true},
+		{SORT, false},
+	} {
+		app := &app{quitChan: make(chan bool, 1)}
+		km.bindings[test.m]["q"].run(app)
+		assert.Equal(t, test.save, <-app.quitChan, modeNames[test.m])
+	}
+}
@@ -1,36 +1,502 @@
 package main
 
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/nsf/termbox-go"
+)
+
 // formatting rules for indiviudal column within a stock/lable win
 
+type columnType int
+
+const (
+	COLUMN_TEXT      columnType = iota
+	COLUMN_PRICE                // price, shown with a unit suffix
+	COLUMN_PERCENT              // percentage, 1.5 is 1.5%
+	COLUMN_VOLUME               // share count, shown with a unit suffix
+	COLUMN_DATE                 // time.Time, zero when unknown
+	COLUMN_SPARKLINE            // []float64 of closing prices, drawn as a line
+)
+
 type Column struct {
 	width     int
 	name      string
 	precision int
+	kind      columnType
+
+	// value returns the column's value for a quote: a string for text
+	// columns, a time.Time for dates and a float64 for everything else
+	value func(q Quote) interface{}
+	// format turns a value into the text of a cell
+	format func(col *Column, v interface{}) string
+	// color is the foreground color of a cell
+	color func(q Quote, v interface{}) termbox.Attribute
+	// less orders two values when sorting by the column
+	less func(a, b interface{}) bool
+
+	history string // price history range the column needs, e.g. "1d"
+	hidden  bool   // hidden until enabled in the column settings
 }
 
 type Layout struct {
-	columns []Column
+	columns []Column // visible columns in display order
+	all     []Column // every column, built-in ones first
+}
+
+const maxColumnWidth = 40
+
+// formats for computed columns
+const (
+	FORMAT_NUMBER  = "number"  // like the built-in price columns, e.g. 1.23M
+	FORMAT_SIGNED  = "signed"  // number with a leading + when positive
+	FORMAT_PERCENT = "percent" // ratio shown as a signed percentage
+	FORMAT_RAW     = "raw"     // plain number, no unit suffix
+)
+
+// customColumn is a user-defined column computed from an expression over the
+// quote fields, saved in the profile
+type customColumn struct {
+	Name      string
+	Expr      string
+	Width     int
+	Precision int
+	Format    string
+}
+
+// quoteFields are the numeric fields of Quote by name, for the built-in
+// columns and for column expressions
+var quoteFields = map[string]func(q Quote) float64{
+	"LastTrade":  func(q Quote) float64 { return q.LastTrade },
+	"Change":     func(q Quote) float64 { return q.Change },
+	"ChangePct":  func(q Quote) float64 { return q.ChangePct },
+	"Open":       func(q Quote) float64 { return q.Open },
+	"Low":        func(q Quote) float64 { return q.Low },
+	"High":       func(q Quote) float64 { return q.High },
+	"Volume":     func(q Quote) float64 { return q.Volume },
+	"AvgVolume":  func(q Quote) float64 { return q.AvgVolume },
+	"PeRatio":    func(q Quote) float64 { return q.PeRatio },
+	"Dividend":   func(q Quote) float64 { return q.Dividend },
+	"MarketCap":  func(q Quote) float64 { return q.MarketCap },
+	"Earnings":   earningsTimestamp,
+	"PreOpen":    func(q Quote) float64 { return q.PreOpen },
+	"AfterHours": func(q Quote) float64 { return q.AfterHours },
+	"Low52":      func(q Quote) float64 { return q.Low52 },
+	"High52":     func(q Quote) float64 { return q.High52 },
+}
+
+func earningsTimestamp(q Quote) float64 {
+	ts, err := q.Earnings.Float64()
+	if err != nil {
+		return math.NaN()
+	}
+	return ts
 }
 
-func NewLayout() *Layout {
+// the column registry, every built-in column in its default order
+func NewLayout(history *historyCache, tags func(ticker string) []string,
+	note func(ticker string) string) *Layout {
 	layout := &Layout{}
 	layout.columns = []Column{
-		{9, `Ticker`, 0},
-		{10, `Last`, 2},
-		{10, `Change`, 2},
-		{10, `Change %`, 2},
-		{10, `Open`, 2},
-		{10, `Low`, 2},
-		{10, `High`, 2},
-		{10, `Volume`, 2},
-		{12, `Avg Volume`, 2},
-		{10, `P/E`, 2},
-		{9, `Divd %`, 2},
-		{10, `Mkt Cap`, 3},
-		{12, `Earnings`, 0},
-		{11, `PreChg %`, 2},
-		{11, `AfterChg %`, 2},
+		newColumn(COLUMN_TEXT, 9, `Ticker`, 0, func(q Quote) interface{} {
+			return q.Ticker
+		}),
+		newFieldColumn(COLUMN_PRICE, 10, `Last`, 2, "LastTrade"),
+		newFieldColumn(COLUMN_PRICE, 10, `Change`, 2, "Change").signed(),
+		newFieldColumn(COLUMN_PERCENT, 10, `Change %`, 2, "ChangePct").signed(),
+		newFieldColumn(COLUMN_PRICE, 10, `Open`, 2, "Open"),
+		newFieldColumn(COLUMN_PRICE, 10, `Low`, 2, "Low"),
+		newFieldColumn(COLUMN_PRICE, 10, `High`, 2, "High"),
+		newFieldColumn(COLUMN_VOLUME, 10, `Volume`, 2, "Volume"),
+		newFieldColumn(COLUMN_VOLUME, 12, `Avg Volume`, 2, "AvgVolume"),
+		newFieldColumn(COLUMN_PRICE, 10, `P/E`, 2, "PeRatio"),
+		newColumn(COLUMN_PERCENT, 9, `Divd %`, 2, func(q Quote) interface{} {
+			// dividend yield is a ratio
+			return q.Dividend * 100
+		}),
+		newFieldColumn(COLUMN_PRICE, 10, `Mkt Cap`, 3, "MarketCap"),
+		newColumn(COLUMN_DATE, 12, `Earnings`, 0, func(q Quote) interface{} {
+			ts := earningsTimestamp(q)
+			if math.IsNaN(ts) {
+				return time.Time{}
+			}
+			return time.Unix(int64(ts), 0)
+		}),
+		newFieldColumn(COLUMN_PERCENT, 11, `PreChg %`, 2, "PreOpen").signed().
+			colorBySign(),
+		newFieldColumn(COLUMN_PERCENT, 11, `AfterChg %`, 2, "AfterHours").signed().
+			colorBySign(),
+		newSparklineColumn(22, `Day`, "1d", history),
+		newSparklineColumn(22, `5 Day`, "5d", history),
+		newTagsColumn(16, `Tags`, tags),
+		newTextColumn(20, `Name`, func(q Quote) string { return q.Name }),
+		newTextColumn(24, `Notes`, func(q Quote) string { return note(q.Ticker) }),
 	}
+	layout.all = append([]Column{}, layout.columns...)
 
 	return layout
 }
+
+// newTagsColumn shows the tags of the ticker, hidden by default
+func newTagsColumn(width int, name string, tags func(ticker string) []string) Column {
+	col := newColumn(COLUMN_TEXT, width, name, 0, func(q Quote) interface{} {
+		return strings.Join(tags(q.Ticker), ",")
+	})
+	col.color = func(q Quote, v interface{}) termbox.Attribute {
+		return colors.label
+	}
+	col.hidden = true
+	return col
+}
+
+// newTextColumn shows some text about the ticker, hidden by default
+func newTextColumn(width int, name string, text func(q Quote) string) Column {
+	col := newColumn(COLUMN_TEXT, width, name, 0, func(q Quote) interface{} {
+		return text(q)
+	})
+	col.hidden = true
+	return col
+}
+
+// newColumn creates a column with the formatter, color rule and comparator
+// of its type
+func newColumn(kind columnType, width int, name string, precision int,
+	value func(q Quote) interface{}) Column {
+
+	col := Column{
+		width:     width,
+		name:      name,
+		precision: precision,
+		kind:      kind,
+		value:     value,
+		format:    formatNumber,
+		color:     colorByChange,
+		less:      lessNumber,
+	}
+
+	switch kind {
+	case COLUMN_TEXT:
+		col.format = formatText
+		col.less = lessText
+	case COLUMN_DATE:
+		col.format = formatDate
+		col.less = lessDate
+	case COLUMN_SPARKLINE:
+		col.format = formatSparkline
+		col.color = colorBySeries
+		col.less = lessSeries
+	}
+	return col
+}
+
+// newSparklineColumn creates an optional column drawing the closing prices
+// of each ticker over rng
+func newSparklineColumn(width int, name string, rng string,
+	history *historyCache) Column {
+
+	col := newColumn(COLUMN_SPARKLINE, width, name, 0, func(q Quote) interface{} {
+		return closes(history.Get(q.Ticker, rng))
+	})
+	col.history = rng
+	col.hidden = true
+	return col
+}
+
+func newFieldColumn(kind columnType, width int, name string, precision int,
+	field string) Column {
+
+	get := quoteFields[field]
+	return newColumn(kind, width, name, precision, func(q Quote) interface{} {
+		return get(q)
+	})
+}
+
+// signed shows a leading + on positive values
+func (col Column) signed() Column {
+	col.format = formatSigned
+	return col
+}
+
+// colorBySign colors the cell by the sign of its own value instead of the
+// day's change
+func (col Column) colorBySign() Column {
+	col.color = func(q Quote, v interface{}) termbox.Attribute {
+		return signColor(v.(float64))
+	}
+	return col
+}
+
+func formatText(col *Column, v interface{}) string {
+	return fmt.Sprintf("%v", v)
+}
+
+func formatNumber(col *Column, v interface{}) string {
+	f := v.(float64)
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "-"
+	}
+	if f < 0 {
+		return "-" + float2Str(-f, col.precision)
+	}
+	return float2Str(f, col.precision)
+}
+
+func formatSigned(col *Column, v interface{}) string {
+	f := v.(float64)
+	if f >= 0 {
+		return "+" + formatNumber(col, v)
+	}
+	return formatNumber(col, v)
+}
+
+func formatDate(col *Column, v interface{}) string {
+	t := v.(time.Time)
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(layoutUS)
+}
+
+func formatSparkline(col *Column, v interface{}) string {
+	if col.width < 2 {
+		return ""
+	}
+	// leave a gap before the next column
+	return sparkline(v.([]float64), col.width-1)
+}
+
+func signColor(v float64) termbox.Attribute {
+	if v > 0 {
+		return colors.up
+	} else if v == 0 {
+		return colors.flat
+	}
+	return colors.down
+}
+
+// colorByChange colors a cell like its row, by the day's change
+func colorByChange(q Quote, v interface{}) termbox.Attribute {
+	return signColor(q.Change)
+}
+
+// colorBySeries colors a sparkline by the direction of the series
+func colorBySeries(q Quote, v interface{}) termbox.Attribute {
+	change := seriesChange(v.([]float64))
+	if math.IsNaN(change) {
+		return colors.flat
+	}
+	return signColor(change)
+}
+
+func lessText(a, b interface{}) bool {
+	return a.(string) < b.(string)
+}
+
+func lessDate(a, b interface{}) bool {
+	return a.(time.Time).Before(b.(time.Time))
+}
+
+// lessSeries orders sparklines by their change over the series
+func lessSeries(a, b interface{}) bool {
+	return lessNumber(seriesChange(a.([]float64)), seriesChange(b.([]float64)))
+}
+
+// lessNumber sorts missing values (NaN) before everything else
+func lessNumber(a, b interface{}) bool {
+	f1, f2 := a.(float64), b.(float64)
+	if math.IsNaN(f1) {
+		return !math.IsNaN(f2)
+	}
+	return f1 < f2
+}
+
+// addCustomColumns appends the computed columns after the built-in ones,
+// skipping any that fail to compile. The first error is returned.
+func (layout *Layout) addCustomColumns(custom []customColumn,
+	indicators *indicatorCache) error {
+
+	var firstErr error
+	for _, c := range custom {
+		col, err := newCustomColumn(c, indicators)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		layout.columns = append(layout.columns, col)
+		layout.all = append(layout.all, col)
+	}
+	return firstErr
+}
+
+// historyRanges returns the price history ranges the visible columns need
+func (layout *Layout) historyRanges() []string {
+	ranges := []string{}
+	for _, col := range layout.columns {
+		if col.history != "" {
+			ranges = append(ranges, col.history)
+		}
+	}
+	return ranges
+}
+
+// newCustomColumn compiles a computed column. Columns using indicators
+// need the daily history and are NaN until it has been fetched.
+func newCustomColumn(c customColumn, indicators *indicatorCache) (Column,
+	error) {
+
+	expr, err := parseExpr(c.Expr)
+	if err != nil {
+		return Column{}, fmt.Errorf("column %s: %v", c.Name, err)
+	}
+
+	width := c.Width
+	if width <= 0 {
+		width = 10
+	}
+	eval := func(q Quote) float64 {
+		return expr.eval(exprEnv{quote: q, indicators: indicators})
+	}
+	value := func(q Quote) interface{} {
+		return eval(q)
+	}
+
+	col, err := newComputedColumn(c, width, eval, value)
+	if err == nil && usesIndicators(expr) {
+		col.history = indicatorRange
+	}
+	return col, err
+}
+
+func newComputedColumn(c customColumn, width int, eval func(q Quote) float64,
+	value func(q Quote) interface{}) (Column, error) {
+
+	switch c.Format {
+	case FORMAT_NUMBER, "":
+		return newColumn(COLUMN_PRICE, width, c.Name, c.Precision, value), nil
+	case FORMAT_SIGNED:
+		return newColumn(COLUMN_PRICE, width, c.Name, c.Precision, value).
+			signed(), nil
+	case FORMAT_PERCENT:
+		col := newColumn(COLUMN_PERCENT, width, c.Name, c.Precision,
+			func(q Quote) interface{} {
+				return eval(q) * 100
+			})
+		col.format = func(col *Column, v interface{}) string {
+			f := v.(float64)
+			if math.IsNaN(f) || math.IsInf(f, 0) {
+				return "-"
+			}
+			return fmt.Sprintf("%+.*f%%", col.precision, f)
+		}
+		return col, nil
+	case FORMAT_RAW:
+		col := newColumn(COLUMN_PRICE, width, c.Name, c.Precision, value)
+		col.format = func(col *Column, v interface{}) string {
+			f := v.(float64)
+			if math.IsNaN(f) || math.IsInf(f, 0) {
+				return "-"
+			}
+			return fmt.Sprintf("%.*f", col.precision, f)
+		}
+		return col, nil
+	}
+	return Column{}, fmt.Errorf("column %s: unknown format '%s'", c.Name,
+		c.Format)
+}
+
+// columnSetting is how a column is shown in a portfolio, the settings of a
+// portfolio are kept in display order
+type columnSetting struct {
+	Name   string
+	Width  int  `json:",omitempty"` // 0 for the default width
+	Hidden bool `json:",omitempty"`
+}
+
+// applySettings picks the visible columns and their order and widths from
+// settings. It returns settings covering every column of the layout: unknown
+// names are dropped and columns missing from settings are appended.
+func (layout *Layout) applySettings(settings []columnSetting) []columnSetting {
+	byName := make(map[string]Column, len(layout.all))
+	for _, col := range layout.all {
+		byName[col.name] = col
+	}
+
+	normalized := []columnSetting{}
+	seen := map[string]bool{}
+	for _, setting := range settings {
+		if _, ok := byName[setting.Name]; ok && !seen[setting.Name] {
+			normalized = append(normalized, setting)
+			seen[setting.Name] = true
+		}
+	}
+	for _, col := range layout.all {
+		if !seen[col.name] {
+			normalized = append(normalized, columnSetting{
+				Name:   col.name,
+				Hidden: col.hidden,
+			})
+		}
+	}
+
+	layout.columns = []Column{}
+	for _, setting := range normalized {
+		if setting.Hidden {
+			continue
+		}
+		col := byName[setting.Name]
+		if setting.Width > 0 {
+			col.width = setting.Width
+		}
+		layout.columns = append(layout.columns, col)
+	}
+
+	if len(layout.columns) == 0 {
+		// never hide everything
+		normalized[0].Hidden = false
+		return layout.applySettings(normalized)
+	}
+	return normalized
+}
+
+// findColumn returns the index of the setting for name, ignoring case and
+// spaces so that "avgvolume" finds "Avg Volume", or -1
+func findColumn(settings []columnSetting, name string) int {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.Replace(s, " ", "", -1))
+	}
+	for id, setting := range settings {
+		if normalize(setting.Name) == normalize(name) {
+			return id
+		}
+	}
+	return -1
+}
+
+// moveColumnSetting moves the setting at from to position to
+func moveColumnSetting(settings []columnSetting, from, to int) {
+	if to < 0 || to >= len(settings) || from == to {
+		return
+	}
+	setting := settings[from]
+	if from < to {
+		copy(settings[from:to], settings[from+1:to+1])
+	} else {
+		copy(settings[to+1:from+1], settings[to:from])
+	}
+	settings[to] = setting
+}
+
+func countVisible(settings []columnSetting) int {
+	visible := 0
+	for _, setting := range settings {
+		if !setting.Hidden {
+			visible++
+		}
+	}
+	return visible
+}
@@ -2,17 +2,23 @@ package main
 
 import (
 	"fmt"
-	"reflect"
+	"path"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/mattn/go-runewidth"
 	"github.com/nsf/termbox-go"
 )
 
 type LineEditor struct {
 	cmd         rune   // keyboard command such as "d" or "a"
-	cursor      int    // cursor pos
-	quoteIndex  int    // currently highlighted quote
+	cursor      int    // byte offset of the cursor in input, always between two characters
+	scroll      int    // columns of the input scrolled off to the left
+	quoteIndex  int    // quote selected when the command was run
 	prompt      string // prompt string for a command
 	input       string // user typed input string
 	promptError string
@@ -21,13 +27,37 @@ type LineEditor struct {
 	profile     *profile       // pointer to profile
 	regex       *regexp.Regexp // regex to split comma-delimited input string
 	commandWin  *Win
+	mode        *mode // pointer to the app mode
+	alertIndex  int   // alert rule being edited, -1 for a new rule
+
+	compareTickers []string // tickers given to the last :compare
+	helpQuery      string   // words given to the last :help
+	selection      []string // tickers a prompt acts on, nil for the selected one
+	deleted        int      // number of tickers the last delete removed
+
+	history     *lineHistory
+	historyPos  int    // entry of the history shown, len(entries) for the draft
+	draft       string // input typed before going through the history
+	searching   bool   // searching the history with Ctrl-R
+	searchQuery string
+	searchFrom  int  // entry the search goes back from
+	searchFound bool // an entry contains the query
+
+	commands   []command   // the : commands
+	sourcing   []string    // files being sourced, against files sourcing each other
+	completion *completion // candidates of the last Tab, nil if none
+	altBracket bool        // the last key was Alt-[, the start of Shift-Tab
 }
 
-func NewLineEditor(profile *profile, quotes *[]Quote, commandWin *Win) *LineEditor {
+func NewLineEditor(profile *profile, quotes *[]Quote, mode *mode, commandWin *Win) *LineEditor {
 	return &LineEditor{
 		quotes:     quotes,
 		profile:    profile,
+		mode:       mode,
 		commandWin: commandWin,
+		alertIndex: -1,
+		history:    loadLineHistory(path.Join(path.Dir(profile.filepath), "history")),
+		commands:   newCommands(),
 	}
 }
 
@@ -37,19 +67,28 @@ func (editor *LineEditor) Prompt(cmd rune, quoteIndex int) {
 		'd': `delete selected ticker? y/n :`,
 		'/': `/`,
 		':': `:`,
+		'A': `alert: `,
+		't': `tags (-tag removes): `,
+		'y': `copy to portfolio: `,
+		'e': `export to file: `,
 	}
 
 	if prompt, ok := prompts[cmd]; ok {
 		editor.prompt = prompt
 		editor.cmd = cmd
 	}
+	editor.historyPos = len(editor.history.Entries(editor.cmd))
+	if cmd == 'd' && len(editor.selection) > 1 {
+		editor.prompt = fmt.Sprintf("delete %d selected tickers? y/n :",
+			len(editor.selection))
+	}
 }
 
 func (editor *LineEditor) Draw() {
 	fg, bg := termbox.ColorDefault, termbox.ColorDefault
 	editor.commandWin.Clear()
 	if editor.promptError != "" {
-		fg, bg = termbox.ColorRed, termbox.ColorWhite
+		fg, bg = colors.errorFg, colors.errorBg
 		editor.commandWin.print(0, 0, fg, bg, editor.promptError)
 		editor.Done()
 		return
@@ -58,29 +97,298 @@ func (editor *LineEditor) Draw() {
 		editor.Done()
 		return
 	} else if editor.prompt != "" {
-		editor.commandWin.print(0, 0, fg, bg, editor.prompt)
-		editor.commandWin.print(len(editor.prompt), 0, fg, bg, editor.input)
-		termbox.SetCursor(len(editor.prompt)+len(editor.input), editor.commandWin.y)
+		prompt := editor.prompt
+		if editor.searching {
+			prompt = fmt.Sprintf("(reverse-i-search)'%s': ", editor.searchQuery)
+			if !editor.searchFound {
+				prompt = "(failed " + prompt[1:]
+			}
+		}
+		editor.commandWin.print(0, 0, fg, bg, prompt)
+		x := runewidth.StringWidth(prompt)
+		editor.drawInput(x, fg, bg)
+		if editor.completion != nil {
+			editor.drawCompletion(x + displayWidth(
+				editor.input[:editor.completion.start]) - editor.scroll)
+		}
 	}
 }
 
+// drawInput draws the input from column x of the command window, scrolled
+// sideways so that the cursor stays on screen, and places the cursor
+func (editor *LineEditor) drawInput(x int, fg, bg termbox.Attribute) {
+	// the last column is kept for the cursor at the end of the input
+	room := editor.commandWin.w - x - 1
+	if room < 2 {
+		room = 2
+	}
+	at := displayWidth(editor.input[:editor.cursor])
+	if at < editor.scroll+1 {
+		// a column of what is before the cursor stays in sight
+		editor.scroll = at - 1
+	} else if at-editor.scroll >= room {
+		editor.scroll = at - room + 1
+	}
+	if editor.scroll < 0 {
+		editor.scroll = 0
+	}
+
+	col := 0
+	for i := 0; i < len(editor.input); {
+		end := nextGrapheme(editor.input, i)
+		w := graphemeWidth(editor.input[i:end])
+		if col >= editor.scroll && col+w-editor.scroll <= room {
+			// the base character, termbox can't combine marks with it
+			r, _ := utf8.DecodeRuneInString(editor.input[i:end])
+			termbox.SetCell(editor.commandWin.x+x+col-editor.scroll,
+				editor.commandWin.y, r, fg, bg)
+		}
+		col += w
+		i = end
+	}
+
+	if editor.scroll > 0 {
+		editor.commandWin.print(x, 0, termbox.ColorYellow, bg, MORE_LEFT_CHAR)
+	}
+	if col-editor.scroll > room {
+		editor.commandWin.print(x+room, 0, termbox.ColorYellow, bg, MORE_RIGHT_CHAR)
+	}
+	termbox.SetCursor(editor.commandWin.x+x+at-editor.scroll, editor.commandWin.y)
+}
+
+// time within which a key after Esc is taken with Esc for Alt and the key,
+// as terminals send Alt-b as Esc b
+const escTimeout = 50 * time.Millisecond
+
+// escKeys tells an Esc typed on its own from one the terminal sent before a
+// key to mean Alt and the key, e.g. Esc b for Alt-b or Esc [ Z for Shift-Tab
+type escKeys struct {
+	timeout <-chan time.Time // fires when an Esc is on its own, nil if none waits
+}
+
+// Press returns the event to handle now, ok is false for an Esc that waits
+// for the next key or the timeout
+func (esc *escKeys) Press(ev termbox.Event) (event termbox.Event, ok bool) {
+	if esc.timeout != nil {
+		esc.timeout = nil
+		if ev.Key != termbox.KeyEsc {
+			ev.Mod |= termbox.ModAlt
+		}
+		return ev, true
+	}
+	if ev.Key == termbox.KeyEsc && ev.Mod == 0 {
+		esc.timeout = time.After(escTimeout)
+		return ev, false
+	}
+	return ev, true
+}
+
+// editorAction is an editing key of the line editor, Handle and the help
+// both read them from editorActions
+type editorAction struct {
+	keys []string                 // names as in keyNames, <M-b> for Alt-b
+	desc string                   // shown in the help
+	run  func(editor *LineEditor) // nil for the keys the app handles itself
+}
+
+// keys of the line editor in the order of the help, any other character
+// is typed in
+var editorActions = []editorAction{
+	{[]string{"<Enter>"}, "run the command", nil},
+	{[]string{"<Esc>"}, "cancel", nil},
+	{[]string{"<BS>", "<C-h>"}, "delete the character before the cursor",
+		func(editor *LineEditor) { editor.deletePrevChar() }},
+	{[]string{"<Del>", "<C-d>"}, "delete the character under the cursor",
+		func(editor *LineEditor) { editor.deleteChar() }},
+	{[]string{"<Left>", "<C-b>"}, "move the cursor left",
+		func(editor *LineEditor) { editor.moveLeft() }},
+	{[]string{"<Right>", "<C-f>"}, "move the cursor right",
+		func(editor *LineEditor) { editor.moveRight() }},
+	{[]string{"<Home>", "<C-a>"}, "move to the start of the line",
+		func(editor *LineEditor) { editor.cursor = 0 }},
+	{[]string{"<End>", "<C-e>"}, "move to the end of the line",
+		func(editor *LineEditor) { editor.cursor = len(editor.input) }},
+	{[]string{"<M-b>"}, "move a word left",
+		func(editor *LineEditor) { editor.cursor = editor.wordStart() }},
+	{[]string{"<M-f>"}, "move a word right",
+		func(editor *LineEditor) { editor.cursor = editor.wordEnd() }},
+	{[]string{"<C-w>"}, "delete the word before the cursor",
+		func(editor *LineEditor) {
+			start := editor.wordStart()
+			editor.input = editor.input[:start] + editor.input[editor.cursor:]
+			editor.cursor = start
+		}},
+	{[]string{"<C-u>"}, "delete to the start of the line",
+		func(editor *LineEditor) {
+			editor.input = editor.input[editor.cursor:]
+			editor.cursor = 0
+		}},
+	{[]string{"<C-k>"}, "delete to the end of the line",
+		func(editor *LineEditor) { editor.input = editor.input[:editor.cursor] }},
+	{[]string{"<Up>", "<C-p>"}, "previous line of the history of the prompt",
+		func(editor *LineEditor) { editor.showHistory(editor.historyPos - 1) }},
+	{[]string{"<Down>", "<C-n>"}, "next line of the history of the prompt",
+		func(editor *LineEditor) { editor.showHistory(editor.historyPos + 1) }},
+	{[]string{"<Tab>"}, "complete commands, portfolios, columns and tickers",
+		func(editor *LineEditor) { editor.complete(1) }},
+	{[]string{"<S-Tab>"}, "the previous completion",
+		func(editor *LineEditor) { editor.complete(-1) }},
+	{[]string{"<C-r>"}, "search the history, again for older lines, <C-g> to stop",
+		func(editor *LineEditor) {
+			editor.searching = true
+			editor.searchQuery = ""
+			editor.searchFrom = editor.historyPos
+			editor.searchFound = true
+			editor.draft = editor.input
+		}},
+	{[]string{"?"}, "this help, on an empty : line", nil},
+}
+
+// findEditorAction returns the action of the key called name, nil if
+// there is none
+func findEditorAction(name string) *editorAction {
+	for id := range editorActions {
+		for _, key := range editorActions[id].keys {
+			if key == name {
+				return &editorActions[id]
+			}
+		}
+	}
+	return nil
+}
+
+// editorKeyName is the name of the key pressed as in editorActions, "" for
+// characters typed in
+func editorKeyName(ev termbox.Event) string {
+	switch {
+	case ev.Mod&termbox.ModAlt != 0 && ev.Ch != 0:
+		return fmt.Sprintf("<M-%c>", ev.Ch)
+	case ev.Ch != 0:
+		return ""
+	}
+	return keyNames[ev.Key]
+}
+
 func (editor *LineEditor) Handle(ev termbox.Event) {
 	defer termbox.Flush()
 
-	switch ev.Key {
-	case termbox.KeySpace:
+	if editor.searching && editor.handleSearch(ev) {
+		return
+	}
+
+	// termbox doesn't know Shift-Tab, it arrives as Esc [ and then Z
+	backtab := editor.altBracket && ev.Ch == 'Z' && ev.Mod == 0
+	editor.altBracket = ev.Mod&termbox.ModAlt != 0 && ev.Ch == '['
+	if editor.altBracket {
+		return
+	}
+	name := editorKeyName(ev)
+	if backtab {
+		name = "<S-Tab>"
+	}
+	// only going through the completions keeps them
+	if name != "<Tab>" && name != "<S-Tab>" {
+		editor.completion = nil
+	}
+
+	if act := findEditorAction(name); act != nil {
+		if act.run != nil {
+			act.run(editor)
+		}
+		return
+	}
+	switch {
+	case ev.Mod&termbox.ModAlt != 0:
+	case ev.Key == termbox.KeySpace:
 		editor.insertCharacter(' ')
-	case termbox.KeyBackspace, termbox.KeyBackspace2:
-		editor.deletePrevChar()
-	case termbox.KeyArrowLeft:
-		editor.moveLeft()
-	case termbox.KeyArrowRight:
-		editor.moveRight()
+	case ev.Ch != 0:
+		editor.insertCharacter(ev.Ch)
+	}
+}
+
+// handleSearch handles a key while searching the history with Ctrl-R and
+// reports whether it was used. Other keys end the search on the entry
+// found and are handled as usual.
+func (editor *LineEditor) handleSearch(ev termbox.Event) bool {
+	switch {
+	case ev.Key == termbox.KeyCtrlR:
+		// the next older match
+		editor.searchHistory(editor.historyPos - 1)
+	case ev.Key == termbox.KeyCtrlG:
+		editor.searching = false
+		editor.input = editor.draft
+		editor.cursor = len(editor.input)
+		editor.historyPos = len(editor.history.Entries(editor.cmd))
+	case ev.Key == termbox.KeyBackspace || ev.Key == termbox.KeyBackspace2:
+		if editor.searchQuery != "" {
+			_, size := utf8.DecodeLastRuneInString(editor.searchQuery)
+			editor.searchQuery = editor.searchQuery[:len(editor.searchQuery)-size]
+		}
+		editor.searchHistory(editor.searchFrom - 1)
+	case ev.Ch != 0 && ev.Mod == 0 || ev.Key == termbox.KeySpace:
+		if ev.Key == termbox.KeySpace {
+			editor.searchQuery += " "
+		} else {
+			editor.searchQuery += string(ev.Ch)
+		}
+		editor.searchHistory(editor.historyPos)
 	default:
-		if ev.Ch != 0 {
-			editor.insertCharacter(ev.Ch)
+		editor.searching = false
+		return false
+	}
+	return true
+}
+
+// searchHistory shows the newest entry from pos back containing the query
+func (editor *LineEditor) searchHistory(pos int) {
+	entries := editor.history.Entries(editor.cmd)
+	if pos >= len(entries) {
+		pos = len(entries) - 1
+	}
+	for ; pos >= 0; pos-- {
+		if i := strings.Index(entries[pos], editor.searchQuery); i >= 0 {
+			editor.historyPos = pos
+			editor.input = entries[pos]
+			editor.cursor = i
+			editor.searchFound = true
+			return
 		}
 	}
+	editor.searchFound = editor.searchQuery == ""
+	if editor.searchQuery == "" {
+		editor.input = editor.draft
+		editor.cursor = len(editor.input)
+	}
+}
+
+// showHistory replaces the input with entry pos of the history, or with
+// what was typed before going through it past the newest entry
+func (editor *LineEditor) showHistory(pos int) {
+	entries := editor.history.Entries(editor.cmd)
+	if pos < 0 || pos > len(entries) {
+		return
+	}
+	if editor.historyPos == len(entries) {
+		editor.draft = editor.input
+	}
+	editor.historyPos = pos
+	if pos == len(entries) {
+		editor.input = editor.draft
+	} else {
+		editor.input = entries[pos]
+	}
+	editor.cursor = len(editor.input)
+}
+
+// Remember adds the input to the history of its prompt
+func (editor *LineEditor) Remember() {
+	if editor.cmd == 'd' {
+		// only y or n
+		return
+	}
+	if err := editor.history.Add(editor.cmd, editor.input); err != nil {
+		editor.PrintErrorf("couldn't save the history: %v", err)
+	}
 }
 
 func (editor *LineEditor) Done() {
@@ -90,6 +398,9 @@ func (editor *LineEditor) Done() {
 	editor.message = ""
 	editor.promptError = ""
 	editor.cursor = 0
+	editor.scroll = 0
+	editor.searching = false
+	editor.completion = nil
 
 	if editor.prompt != "" {
 		termbox.SetCursor(len(editor.prompt)+len(editor.input), editor.commandWin.y)
@@ -100,7 +411,23 @@ func (editor *LineEditor) Done() {
 func (editor *LineEditor) Execute(selectedQuote int) (newQuote int) {
 	switch editor.cmd {
 	case 'd':
+		editor.deleted = 0
+		if strings.TrimSpace(strings.ToLower(editor.input)) == "y" &&
+			len(editor.selection) > 0 {
+			first := getQuoteId(*editor.quotes, editor.selection[0])
+			for _, ticker := range editor.selection {
+				editor.profile.Tickers = removeTicker(editor.profile.Tickers, ticker)
+			}
+			editor.deleted = len(editor.selection)
+			// the row before the first one deleted, the top when that was the
+			// first row or isn't shown, e.g. hidden by the filter
+			if first < 1 {
+				return 0
+			}
+			return first - 1
+		}
 		if strings.TrimSpace(strings.ToLower(editor.input)) == "y" {
+			editor.deleted = 1
 			for id := range *editor.quotes {
 				if q := (*editor.quotes)[id]; id == selectedQuote {
 					// remove from list of tickers
@@ -109,64 +436,378 @@ func (editor *LineEditor) Execute(selectedQuote int) (newQuote int) {
 				}
 			}
 		}
-	case '/':
-		// perform a search on a ticker
-		return getTickerId(editor.profile.Tickers, strings.TrimSpace(strings.ToUpper(editor.input)))
 	case ':':
-		args := editor.tokenize(" ")
+		line := editor.input
 		editor.input = ""
 		termbox.HideCursor()
 		termbox.Flush()
-		if args[0] == "save" {
-			portfolioName := args[1]
-			editor.profile.Portfolios[portfolioName] = portfolio{
-				Tickers: append([]string{}, editor.profile.Tickers...),
+		editor.quoteIndex = selectedQuote
+		editor.RunCommand(line)
+		return 0
+	case 'A':
+		return editor.addAlert(editor.input)
+	case 't':
+		editor.tagTickers(editor.selectedTickers(selectedQuote), editor.tokenize(" "))
+	case 'y':
+		editor.copyTickers(editor.selectedTickers(selectedQuote),
+			strings.TrimSpace(editor.input))
+	}
+	return 0
+}
+
+// selectedTickers returns the tickers a prompt acts on
+func (editor *LineEditor) selectedTickers(selectedQuote int) []string {
+	if len(editor.selection) > 0 {
+		return editor.selection
+	}
+	if editor.quotes == nil || selectedQuote < 0 ||
+		selectedQuote >= len(*editor.quotes) {
+		return nil
+	}
+	return []string{(*editor.quotes)[selectedQuote].Ticker}
+}
+
+// tagTickers adds tags to tickers, or removes them when prefixed with '-'
+func (editor *LineEditor) tagTickers(tickers []string, tags []string) {
+	if editor.profile.Tags == nil {
+		editor.profile.Tags = map[string][]string{}
+	}
+	for _, ticker := range tickers {
+		key := strings.ToUpper(ticker)
+		for _, tag := range tags {
+			tag = strings.ToLower(tag)
+			if strings.HasPrefix(tag, "-") {
+				editor.profile.Tags[key] = removeTag(editor.profile.Tags[key], tag[1:])
+			} else if tag != "" && !hasTag(editor.profile.Tags[key], tag) {
+				editor.profile.Tags[key] = append(editor.profile.Tags[key], tag)
 			}
-			editor.message = fmt.Sprintf("saved portfolio as '%s'", portfolioName)
-		} else if args[0] == "load" {
-			portfolioName := args[1]
-			portfolio, ok := editor.profile.Portfolios[portfolioName]
-			if !ok {
-				editor.PrintErrorf("portfolio not found: %s", portfolioName)
-				return -1
-			} else {
-				editor.profile.Tickers = append([]string{}, portfolio.Tickers...)
-
-				editor.message = fmt.Sprintf("loaded portfolio '%s'", portfolioName)
+		}
+		if len(editor.profile.Tags[key]) == 0 {
+			delete(editor.profile.Tags, key)
+		}
+	}
+	editor.message = fmt.Sprintf("tagged %d ticker(s)", len(tickers))
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func removeTag(tags []string, tag string) []string {
+	result := []string{}
+	for _, t := range tags {
+		if t != tag {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// setNote sets the note of tickers, an empty note removes it
+func (editor *LineEditor) setNote(tickers []string, note string) {
+	if editor.profile.Notes == nil {
+		editor.profile.Notes = map[string]string{}
+	}
+	note = strings.TrimSpace(note)
+	for _, ticker := range tickers {
+		if note == "" {
+			delete(editor.profile.Notes, strings.ToUpper(ticker))
+		} else {
+			editor.profile.Notes[strings.ToUpper(ticker)] = note
+		}
+	}
+	if note == "" {
+		editor.message = fmt.Sprintf("removed the note of %d ticker(s)", len(tickers))
+	} else {
+		editor.message = fmt.Sprintf("noted %d ticker(s)", len(tickers))
+	}
+}
+
+// copyTickers adds tickers to a saved portfolio, creating it if needed
+func (editor *LineEditor) copyTickers(tickers []string, name string) {
+	if name == "" {
+		editor.PrintErrorf("usage: copy to <portfolio>")
+		return
+	}
+	p := editor.profile.Portfolios[name]
+	copied := 0
+	for _, ticker := range tickers {
+		if getTickerId(p.Tickers, ticker) == -1 {
+			p.Tickers = append(p.Tickers, ticker)
+			copied++
+		}
+	}
+	editor.profile.Portfolios[name] = p
+	if name == editor.profile.current {
+		editor.profile.Tickers = append([]string{}, p.Tickers...)
+	}
+	editor.message = fmt.Sprintf("copied %d ticker(s) to '%s'", copied, name)
+}
+
+// setSort sets the sort of the portfolio, e.g. "Chg %, Volume desc", or
+// goes back to the manual order with "manual". No spec shows the sort.
+func (editor *LineEditor) setSort(spec string) {
+	spec = strings.TrimSpace(spec)
+	switch strings.ToLower(spec) {
+	case "":
+		editor.message = "sorted by " + formatSortSpec(editor.profile.sort)
+		return
+	case "manual", "off":
+		editor.profile.sort = nil
+	default:
+		keys, err := parseSortSpec(spec, editor.profile.columns)
+		if err != nil {
+			editor.PrintErrorf("sort: %v", err)
+			return
+		}
+		editor.profile.sort = keys
+	}
+	editor.profile.saveSettings()
+	editor.message = "sorted by " + formatSortSpec(editor.profile.sort)
+}
+
+// setFilter shows only the tickers for which expr holds, e.g.
+// "rsi(14) < 30 and Volume > AvgVolume". An empty expr shows all tickers.
+func (editor *LineEditor) setFilter(expr string) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		editor.profile.filter = ""
+		editor.message = "showing all tickers"
+		return
+	}
+	if _, err := parseExpr(expr); err != nil {
+		editor.PrintErrorf("filter: %v", err)
+		return
+	}
+	editor.profile.filter = expr
+	editor.message = fmt.Sprintf("filtering on '%s'", expr)
+}
+
+// setOverlays sets the indicators drawn over price charts, e.g.
+// "sma(20) ema(50)". No arguments removes all overlays.
+func (editor *LineEditor) setOverlays(args []string) {
+	overlays := []string{}
+	for _, arg := range args {
+		if arg == "" {
+			continue
+		}
+		ind, err := parseIndicator(arg)
+		if err != nil {
+			editor.PrintErrorf("overlays: %v", err)
+			return
+		}
+		if !ind.overlay() {
+			editor.PrintErrorf("overlays: %s isn't on the price scale", ind)
+			return
+		}
+		overlays = append(overlays, ind.String())
+	}
+	editor.profile.ChartOverlays = overlays
+	editor.message = fmt.Sprintf("chart overlays: %s", strings.Join(overlays, " "))
+}
+
+// setNotifier configures a delivery channel, e.g. "webhook http://host/hook"
+func (editor *LineEditor) setNotifier(args []string) {
+	config := &editor.profile.Notifiers
+	if len(args) == 0 || args[0] == "" {
+		editor.message = fmt.Sprintf("exec: '%s' webhook: '%s'", config.Exec,
+			config.Webhook)
+		return
+	}
+
+	value := strings.Join(args[1:], " ")
+	switch alertChannel(args[0]) {
+	case CHANNEL_EXEC:
+		config.Exec = value
+	case CHANNEL_WEBHOOK:
+		config.Webhook = value
+	default:
+		editor.PrintErrorf("usage: notify exec|webhook <value>")
+		return
+	}
+	editor.message = fmt.Sprintf("%s notifier set to '%s'", args[0], value)
+}
+
+// editColumns adds, removes or changes how a column is shown:
+//
+//	column add <name> <expression>
+//	column del <name>
+//	column hide|show <name>
+//	column move <name> <position>
+//	column width <name> <width>
+func (editor *LineEditor) editColumns(args []string) {
+	if len(args) >= 3 && args[0] == "add" {
+		c := customColumn{
+			Name:      args[1],
+			Expr:      strings.Join(args[2:], " "),
+			Width:     10,
+			Precision: 2,
+			Format:    FORMAT_NUMBER,
+		}
+		if _, err := newCustomColumn(c, nil); err != nil {
+			editor.PrintErrorf("%v", err)
+			return
+		}
+		if findColumn(editor.profile.columns, c.Name) >= 0 &&
+			findCustomColumn(editor.profile.Columns, c.Name) < 0 {
+			editor.PrintErrorf("'%s' is a built-in column", c.Name)
+			return
+		}
+		editor.profile.Columns = append(removeColumn(editor.profile.Columns,
+			c.Name), c)
+		editor.message = fmt.Sprintf("added column '%s'", c.Name)
+		return
+	} else if len(args) == 2 && args[0] == "del" {
+		columns := removeColumn(editor.profile.Columns, args[1])
+		if len(columns) == len(editor.profile.Columns) {
+			editor.PrintErrorf("no column named '%s'", args[1])
+			return
+		}
+		editor.profile.Columns = columns
+		editor.message = fmt.Sprintf("deleted column '%s'", args[1])
+		return
+	}
+
+	settings := editor.profile.columns
+	var id int
+	switch {
+	case len(args) >= 2 && (args[0] == "hide" || args[0] == "show"):
+		id = findColumn(settings, strings.Join(args[1:], " "))
+		if id < 0 {
+			editor.PrintErrorf("no column named '%s'", strings.Join(args[1:], " "))
+			return
+		}
+		if args[0] == "hide" && !settings[id].Hidden && countVisible(settings) == 1 {
+			editor.PrintErrorf("can't hide the last column")
+			return
+		}
+		settings[id].Hidden = args[0] == "hide"
+	case len(args) >= 3 && (args[0] == "move" || args[0] == "width"):
+		name := strings.Join(args[1:len(args)-1], " ")
+		id = findColumn(settings, name)
+		if id < 0 {
+			editor.PrintErrorf("no column named '%s'", name)
+			return
+		}
+		n, err := strconv.Atoi(args[len(args)-1])
+		if args[0] == "move" {
+			if err != nil || n < 1 || n > len(settings) {
+				editor.PrintErrorf("position must be between 1 and %d", len(settings))
+				return
 			}
-		} else if args[0] == "new" {
-			editor.profile.Tickers = []string{}
-			editor.message = fmt.Sprintf("creating new portfolio")
-		} else if args[0] == "list" {
-			editor.message = fmt.Sprintf("saved portfolios: '%s'", reflect.ValueOf(editor.profile.Portfolios).MapKeys())
+			moveColumnSetting(settings, id, n-1)
 		} else {
-			editor.PrintErrorf("could not recognize command '%s'", args[0])
+			if err != nil || n < 1 || n > maxColumnWidth {
+				editor.PrintErrorf("width must be between 1 and %d", maxColumnWidth)
+				return
+			}
+			settings[id].Width = n
 		}
-		return 0
+	default:
+		editor.PrintErrorf("usage: column add|del|hide|show|move|width <name> [value]")
+		return
+	}
+	editor.profile.saveSettings()
+	editor.message = fmt.Sprintf("updated column '%s'", settings[id].Name)
+}
+
+func findCustomColumn(columns []customColumn, name string) int {
+	for i, c := range columns {
+		if c.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func removeColumn(columns []customColumn, name string) []customColumn {
+	for i, c := range columns {
+		if c.Name == name {
+			return append(columns[:i:i], columns[i+1:]...)
+		}
+	}
+	return columns
+}
+
+// addAlert stores the rule in spec, replacing the rule at alertIndex if set
+func (editor *LineEditor) addAlert(spec string) int {
+	rule, err := parseAlertRule(spec)
+	if err != nil {
+		editor.PrintErrorf("invalid alert: %v", err)
+		return -1
+	}
+
+	if editor.alertIndex >= 0 && editor.alertIndex < len(editor.profile.Alerts) {
+		editor.profile.Alerts[editor.alertIndex] = rule
+		editor.message = fmt.Sprintf("updated alert '%s'", rule)
+	} else {
+		editor.profile.Alerts = append(editor.profile.Alerts, rule)
+		editor.message = fmt.Sprintf("added alert '%s'", rule)
 	}
 	return 0
 }
 
+// AsksForHelp reports whether ev is a ? typed on an empty : line, where it
+// can't start anything, unlike a search or a tag
+func (editor *LineEditor) AsksForHelp(ev termbox.Event) bool {
+	return ev.Ch == '?' && editor.cmd == ':' && editor.input == ""
+}
+
 func (editor *LineEditor) PrintErrorf(format string, a ...interface{}) {
 	editor.promptError = fmt.Sprintf(format, a...)
 }
 
+// AddQuotes adds the tickers typed, separated by commas or spaces, once the
+// provider confirms they exist. It returns the last ticker of the input now
+// in the list, "" if there is none, and an error naming those left out.
 func (editor *LineEditor) AddQuotes() (ticker string, err error) {
-	// input for tickers should match "GOOG" or "GOOG, AAPL" ignoring whitespace inbetween
-	validFmt := regexp.MustCompile(`^\s*([a-zA-Z-]+)(,\s*[a-zA-Z-]+\s*)*$`)
-	if !validFmt.MatchString(editor.input) {
-		return editor.input, fmt.Errorf("parse error")
+	symbols, err := parseSymbols(editor.input)
+	if err != nil {
+		return "", err
 	}
-	tickers := editor.tokenize(",")
-	for _, ticker := range tickers {
-		// ignore duplicate tickers
-		if getTickerId(editor.profile.Tickers, ticker) == -1 {
-			editor.profile.Tickers = append(editor.profile.Tickers, ticker)
+
+	// only the tickers not in the list yet need checking
+	unchecked := []string{}
+	for _, symbol := range symbols {
+		if getTickerId(editor.profile.Tickers, symbol) == -1 &&
+			getTickerId(unchecked, symbol) == -1 {
+			unchecked = append(unchecked, symbol)
+		}
+	}
+	found := map[string]bool{}
+	if len(unchecked) > 0 {
+		quotes, err := fetchQuotes(unchecked)
+		if err != nil {
+			return "", fmt.Errorf("couldn't check the tickers: %v", err)
+		}
+		for _, q := range *quotes {
+			found[strings.ToUpper(q.Ticker)] = true
 		}
 	}
 
-	// return the last ticker added so we can select it
-	return tickers[len(tickers)-1], nil
+	unknown := []string{}
+	for _, symbol := range symbols {
+		if getTickerId(editor.profile.Tickers, symbol) == -1 {
+			if !found[symbol] {
+				if getTickerId(unknown, symbol) == -1 {
+					unknown = append(unknown, symbol)
+				}
+				continue
+			}
+			editor.profile.Tickers = append(editor.profile.Tickers, symbol)
+		}
+		// the last ticker is selected
+		ticker = symbol
+	}
+	if len(unknown) > 0 {
+		return ticker, unknownSymbols(unknown, editor.knownSymbols())
+	}
+	return ticker, nil
 }
 
 func removeTicker(s []string, r string) []string {
@@ -178,39 +819,129 @@ func removeTicker(s []string, r string) []string {
 	return s
 }
 func (editor *LineEditor) insertCharacter(ch rune) {
-	if editor.cursor < len(editor.input) {
-		// Insert the character in the middle of the input string.
-		editor.input = editor.input[0:editor.cursor] + string(ch) + editor.input[editor.cursor:len(editor.input)]
-	} else {
-		// Append the character to the end of the input string.
-		editor.input += string(ch)
-	}
-	editor.moveRight()
+	// Insert the character at the cursor, a combining mark joins the
+	// character before it.
+	editor.input = editor.input[:editor.cursor] + string(ch) + editor.input[editor.cursor:]
+	editor.cursor += utf8.RuneLen(ch)
 }
 
 func (editor *LineEditor) deletePrevChar() {
 	if editor.cursor > 0 {
-		if editor.cursor < len(editor.input) {
-			// remove character in the middle
-			editor.input = editor.input[0:editor.cursor-1] + editor.input[editor.cursor:len(editor.input)]
-		} else {
-			// remove last input characters
-			editor.input = editor.input[:len(editor.input)-1]
-		}
-		editor.moveLeft()
+		start := prevGrapheme(editor.input, editor.cursor)
+		editor.input = editor.input[:start] + editor.input[editor.cursor:]
+		editor.cursor = start
 	}
 }
 
-func (editor *LineEditor) moveRight() {
+// deleteChar deletes the character under the cursor
+func (editor *LineEditor) deleteChar() {
 	if editor.cursor < len(editor.input) {
-		editor.cursor++
+		editor.input = editor.input[:editor.cursor] +
+			editor.input[nextGrapheme(editor.input, editor.cursor):]
+	}
+}
+
+// wordStart is the start of the word before the cursor, as for Ctrl-W
+func (editor *LineEditor) wordStart() int {
+	i := editor.cursor
+	for i > 0 && editor.input[i-1] == ' ' {
+		i--
+	}
+	for i > 0 && editor.input[i-1] != ' ' {
+		i--
 	}
+	return i
+}
+
+// wordEnd is the end of the word after the cursor, as for Alt-F
+func (editor *LineEditor) wordEnd() int {
+	i := editor.cursor
+	for i < len(editor.input) && editor.input[i] == ' ' {
+		i++
+	}
+	for i < len(editor.input) && editor.input[i] != ' ' {
+		i++
+	}
+	return i
+}
+
+func (editor *LineEditor) moveRight() {
+	editor.cursor = nextGrapheme(editor.input, editor.cursor)
 }
 
 func (editor *LineEditor) moveLeft() {
-	if editor.cursor > 0 {
-		editor.cursor--
+	editor.cursor = prevGrapheme(editor.input, editor.cursor)
+}
+
+// extends reports whether r belongs to the character before it: combining
+// marks, variation selectors, skin tones and zero width joiners
+func extends(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc,
+		unicode.Variation_Selector) || r == '\u200d' || r >= 0x1f3fb && r <= 0x1f3ff
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1f1e6 && r <= 0x1f1ff
+}
+
+// nextGrapheme returns the end of the character starting at byte i of s, a
+// rune along with the runes extending it, the rune after a zero width
+// joiner and the second regional indicator of a flag
+func nextGrapheme(s string, i int) int {
+	if i >= len(s) {
+		return len(s)
+	}
+	r, size := utf8.DecodeRuneInString(s[i:])
+	i += size
+	flag := isRegionalIndicator(r)
+	for i < len(s) {
+		next, size := utf8.DecodeRuneInString(s[i:])
+		if !extends(next) && r != '\u200d' && !(flag && isRegionalIndicator(next)) {
+			break
+		}
+		flag = false
+		r = next
+		i += size
+	}
+	return i
+}
+
+// prevGrapheme returns the start of the character ending at byte i of s
+func prevGrapheme(s string, i int) int {
+	start := 0
+	for start < i {
+		end := nextGrapheme(s, start)
+		if end >= i {
+			break
+		}
+		start = end
+	}
+	return start
+}
+
+// graphemeWidth is the number of columns taken by a character, that of its
+// first rune as termbox draws only that one
+func graphemeWidth(g string) int {
+	r, size := utf8.DecodeRuneInString(g)
+	if isRegionalIndicator(r) && len(g) > size {
+		// a flag
+		return 2
+	}
+	if w := runewidth.RuneWidth(r); w > 0 {
+		return w
+	}
+	return 1
+}
+
+// displayWidth is the number of columns taken by s
+func displayWidth(s string) int {
+	width := 0
+	for i := 0; i < len(s); {
+		end := nextGrapheme(s, i)
+		width += graphemeWidth(s[i:end])
+		i = end
 	}
+	return width
 }
 
 func (editor *LineEditor) tokenize(delim string) []string {
@@ -223,7 +954,17 @@ func (editor *LineEditor) tokenize(delim string) []string {
 
 func getTickerId(tickers []string, ticker string) int {
 	for p, v := range tickers {
-		if v == ticker {
+		if strings.EqualFold(v, ticker) {
+			return p
+		}
+	}
+	return -1
+}
+
+// getQuoteId returns the position of ticker in the list as shown
+func getQuoteId(quotes []Quote, ticker string) int {
+	for p, q := range quotes {
+		if q.Ticker == ticker {
 			return p
 		}
 	}
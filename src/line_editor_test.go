@@ -0,0 +1,204 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nsf/termbox-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAsksForHelpOnlyOnAnEmptyColonLine(t *testing.T) {
+	question := termbox.Event{Type: termbox.EventKey, Ch: '?'}
+	for _, test := range []struct {
+		cmd   rune
+		input string
+		want  bool
+	}{
+		{':', "", true},
+		{':', "set", false},
+		{'/', "", false}, // a search for "?"
+		{'t', "", false},
+		{'a', "", false},
+	} {
+		editor := &LineEditor{cmd: test.cmd, input: test.input}
+		assert.Equal(t, test.want, editor.AsksForHelp(question), "%c%s", test.cmd,
+			test.input)
+	}
+	editor := &LineEditor{cmd: ':'}
+	assert.False(t, editor.AsksForHelp(termbox.Event{Type: termbox.EventKey, Ch: 'h'}))
+}
+
+func key(ch rune) termbox.Event {
+	return termbox.Event{Type: termbox.EventKey, Ch: ch}
+}
+
+var escKey = termbox.Event{Type: termbox.EventKey, Key: termbox.KeyEsc}
+
+func TestEscOnItsOwnWaitsForTheTimeout(t *testing.T) {
+	var esc escKeys
+	_, ok := esc.Press(escKey)
+	assert.False(t, ok)
+	select {
+	case <-esc.timeout:
+	case <-time.After(time.Second):
+		t.Fatal("no timeout after Esc")
+	}
+}
+
+func TestEscAndAKeyAreAlt(t *testing.T) {
+	var esc escKeys
+	_, ok := esc.Press(escKey)
+	assert.False(t, ok)
+	ev, ok := esc.Press(key('b'))
+	assert.True(t, ok)
+	assert.Equal(t, termbox.ModAlt, ev.Mod)
+	assert.Equal(t, 'b', ev.Ch)
+	assert.Nil(t, esc.timeout)
+
+	// keys without Esc are left alone
+	ev, ok = esc.Press(key('b'))
+	assert.True(t, ok)
+	assert.Equal(t, termbox.Modifier(0), ev.Mod)
+
+	// a second Esc cancels at once
+	esc.Press(escKey)
+	ev, ok = esc.Press(escKey)
+	assert.True(t, ok)
+	assert.Equal(t, termbox.KeyEsc, ev.Key)
+	assert.Equal(t, termbox.Modifier(0), ev.Mod)
+}
+
+// typeKeys sends the keys to the editor the way the app loop does
+func typeKeys(editor *LineEditor, keys ...termbox.Event) {
+	var esc escKeys
+	for _, k := range keys {
+		if ev, ok := esc.Press(k); ok {
+			editor.Handle(ev)
+		}
+	}
+}
+
+func TestAltWordMotionsFromEsc(t *testing.T) {
+	editor := &LineEditor{cmd: ':', input: "column hide Volume"}
+	editor.cursor = len(editor.input)
+
+	typeKeys(editor, escKey, key('b'))
+	assert.Equal(t, len("column hide "), editor.cursor)
+	typeKeys(editor, escKey, key('b'))
+	assert.Equal(t, len("column "), editor.cursor)
+	typeKeys(editor, escKey, key('f'))
+	assert.Equal(t, len("column hide"), editor.cursor)
+	assert.Equal(t, "column hide Volume", editor.input)
+}
+
+func TestShiftTabFromEsc(t *testing.T) {
+	editor := &LineEditor{cmd: ':', profile: &profile{}, commands: newCommands()}
+	editor.input = "co"
+	editor.cursor = 2
+
+	tab := termbox.Event{Type: termbox.EventKey, Key: termbox.KeyTab}
+	typeKeys(editor, tab)
+	assert.Equal(t, "co", editor.input) // what column, columns and compare share
+	typeKeys(editor, tab)
+	assert.Equal(t, "column", editor.input)
+	typeKeys(editor, tab)
+	assert.Equal(t, "columns", editor.input)
+	typeKeys(editor, escKey, key('['), key('Z'))
+	assert.Equal(t, "column", editor.input)
+}
+
+// editorState is what a key in the line editor can change
+type editorState struct {
+	input              string
+	cursor, historyPos int
+	searching          bool
+	completing         bool
+}
+
+// acceptsKeys returns whether the keys change a line editor with some input
+// and history
+func acceptsKeys(keys ...termbox.Event) bool {
+	editor := &LineEditor{cmd: ':', profile: &profile{}, commands: newCommands(),
+		history: &lineHistory{entries: map[rune][]string{
+			':': {"load work", "set nomarket"}}}}
+	editor.input, editor.cursor, editor.historyPos = "co cd", 2, 1
+
+	state := func() editorState {
+		return editorState{editor.input, editor.cursor, editor.historyPos,
+			editor.searching, editor.completion != nil}
+	}
+	before := state()
+	typeKeys(editor, keys...)
+	return state() != before
+}
+
+func TestHelpListsEveryLineEditorKey(t *testing.T) {
+	listed := map[string]bool{}
+	for _, entry := range lineEditorHelp() {
+		for _, k := range strings.Fields(entry.keys) {
+			listed[k] = true
+		}
+	}
+
+	events := []termbox.Event{}
+	for k := termbox.Key(0); k <= termbox.KeyBackspace2; k++ {
+		// <Space> types a space like any other character
+		if k != termbox.KeySpace && k != termbox.KeyEsc {
+			events = append(events, termbox.Event{Type: termbox.EventKey, Key: k})
+		}
+	}
+	for k := termbox.KeyF1; k >= termbox.MouseWheelDown; k-- {
+		events = append(events, termbox.Event{Type: termbox.EventKey, Key: k})
+	}
+	for ch := 'a'; ch <= 'z'; ch++ {
+		events = append(events, termbox.Event{Type: termbox.EventKey, Ch: ch,
+			Mod: termbox.ModAlt})
+	}
+
+	accepted := map[string]bool{}
+	for _, ev := range events {
+		if acceptsKeys(ev) {
+			name := editorKeyName(ev)
+			assert.True(t, listed[name], "key %v %q (%s) missing from the help",
+				ev.Key, ev.Ch, name)
+			accepted[name] = true
+		}
+	}
+	if acceptsKeys(escKey, key('['), key('Z')) {
+		accepted["<S-Tab>"] = true
+	}
+
+	// and every key of the help with an action does something
+	bound := map[string]bool{}
+	for _, act := range editorActions {
+		for _, k := range act.keys {
+			if act.run != nil {
+				bound[k] = true
+			}
+		}
+	}
+	assert.Equal(t, bound, accepted)
+}
+
+func TestDeleteSelectionSelectsTheRowBefore(t *testing.T) {
+	for _, test := range []struct {
+		selection []string
+		want      int
+	}{
+		{[]string{"IBM", "AMZN"}, 1},
+		{[]string{"AAPL", "MSFT"}, 0},
+		// the first selected is hidden by a filter
+		{[]string{"TSLA", "IBM"}, 0},
+	} {
+		quotes := []Quote{{Ticker: "AAPL"}, {Ticker: "MSFT"}, {Ticker: "IBM"},
+			{Ticker: "AMZN"}}
+		editor := &LineEditor{cmd: 'd', input: "y", quotes: &quotes,
+			selection: test.selection,
+			profile:   &profile{Tickers: []string{"AAPL", "MSFT", "IBM", "AMZN", "TSLA"}}}
+		assert.Equal(t, test.want, editor.Execute(0), test.selection)
+		assert.Equal(t, len(test.selection), editor.deleted, test.selection)
+		assert.NotContains(t, editor.profile.Tickers, test.selection[1])
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// most entries kept for each prompt
+const maxHistory = 200
+
+// lineHistory is what was typed at each prompt, oldest first. It is saved
+// one entry per line starting with the prompt's command, e.g. ":load work"
+// or "/apple".
+type lineHistory struct {
+	path    string
+	entries map[rune][]string
+}
+
+func loadLineHistory(path string) *lineHistory {
+	history := &lineHistory{path: path, entries: map[rune][]string{}}
+	file, err := os.Open(path)
+	if err != nil {
+		return history
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		cmd, size := utf8.DecodeRuneInString(scanner.Text())
+		if size == 0 {
+			continue
+		}
+		history.entries[cmd] = append(history.entries[cmd], scanner.Text()[size:])
+	}
+	return history
+}
+
+// Entries returns the history of the prompt of cmd
+func (history *lineHistory) Entries(cmd rune) []string {
+	return history.entries[cmd]
+}
+
+// Add appends input to the history of cmd, moving it to the end if it was
+// typed before, and saves the history
+func (history *lineHistory) Add(cmd rune, input string) error {
+	input = strings.TrimSpace(input)
+	if input == "" || strings.ContainsAny(input, "\r\n") {
+		return nil
+	}
+	entries := []string{}
+	for _, entry := range history.entries[cmd] {
+		if entry != input {
+			entries = append(entries, entry)
+		}
+	}
+	entries = append(entries, input)
+	if len(entries) > maxHistory {
+		entries = entries[len(entries)-maxHistory:]
+	}
+	history.entries[cmd] = entries
+	return history.Save()
+}
+
+func (history *lineHistory) Save() error {
+	var b strings.Builder
+	for cmd, entries := range history.entries {
+		for _, entry := range entries {
+			b.WriteRune(cmd)
+			b.WriteString(entry)
+			b.WriteString("\n")
+		}
+	}
+	return ioutil.WriteFile(history.path, []byte(b.String()), 0600)
+}
@@ -12,6 +12,7 @@ func main() {
 	}
 
 	defer termbox.Close()
+	termbox.SetInputMode(termbox.InputEsc | termbox.InputMouse)
 
 	app := newApp()
 
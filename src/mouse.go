@@ -0,0 +1,122 @@
+package main
+
+import (
+	"time"
+
+	"github.com/nsf/termbox-go"
+)
+
+// two clicks on the same row within this are a double click
+const doubleClickInterval = 400 * time.Millisecond
+
+// rows scrolled by one step of the mouse wheel
+const wheelRows = 3
+
+// marketHit is the area a market index was drawn in, relative to marketWin
+type marketHit struct {
+	x, y, w int
+	ticker  string
+}
+
+type click struct {
+	y  int
+	at time.Time
+}
+
+// contains reports whether the screen position x, y is inside win
+func (win *Win) contains(x, y int) bool {
+	return x >= win.x && x < win.x+win.w && y >= win.y && y < win.y+win.h
+}
+
+// HandleMouse handles a mouse event in the stock list: clicking a row
+// selects it and double clicking opens its chart, clicking a column header
+// sorts by it, the wheel scrolls the list and clicking a market index opens
+// its chart
+func (ui *Ui) HandleMouse(ev termbox.Event) {
+	switch ev.Key {
+	case termbox.MouseWheelUp:
+		if ui.stockWin.contains(ev.MouseX, ev.MouseY) {
+			ui.scrollStocks(-wheelRows)
+			ui.Draw()
+		}
+	case termbox.MouseWheelDown:
+		if ui.stockWin.contains(ev.MouseX, ev.MouseY) {
+			ui.scrollStocks(wheelRows)
+			ui.Draw()
+		}
+	case termbox.MouseLeft:
+		double := ui.isDoubleClick(ev.MouseY)
+		switch {
+		case ui.stockWin.contains(ev.MouseX, ev.MouseY):
+			ui.clickStock(ev.MouseY-ui.stockWin.y, double)
+		case ui.labelWin.contains(ev.MouseX, ev.MouseY):
+			ui.clickLabel(ev.MouseX - ui.labelWin.x)
+		case ui.marketWin.contains(ev.MouseX, ev.MouseY):
+			ui.clickMarket(ev.MouseX-ui.marketWin.x, ev.MouseY-ui.marketWin.y)
+		}
+	}
+}
+
+func (ui *Ui) isDoubleClick(y int) bool {
+	now := time.Now()
+	double := ui.lastClick.y == y && now.Sub(ui.lastClick.at) < doubleClickInterval
+	if double {
+		// a third click starts over
+		ui.lastClick = click{}
+	} else {
+		ui.lastClick = click{y: y, at: now}
+	}
+	return double
+}
+
+func (ui *Ui) clickStock(row int, double bool) {
+	if ui.stockQuotes == nil || row >= len(ui.visibleQuotes) ||
+		ui.visibleQuotes[row].Ticker == "" {
+		return
+	}
+	ui.selectedQuote = ui.zerothQuote + row
+	ui.selectedVisibleQuote = row
+	if double {
+		ui.OpenChart()
+		return
+	}
+	ui.Draw()
+}
+
+// clickLabel sorts by the clicked column, ascending first and flipping the
+// direction when the sorted column is clicked again
+func (ui *Ui) clickLabel(x int) {
+	if ui.stockQuotes == nil {
+		return
+	}
+	shown, _ := ui.shownColumns()
+	left := 0
+	for _, i := range shown {
+		width := ui.layout.columns[i].width
+		if x >= left && x < left+width {
+			spec := ui.profile.sort
+			name := ui.layout.columns[i].name
+			descending := len(spec) == 1 && spec[0].Column == name &&
+				!spec[0].Descending
+			ui.selectedLabel = i
+			ui.sortByLabel(descending, false)
+			ui.Draw()
+			return
+		}
+		left += width
+	}
+}
+
+func (ui *Ui) clickMarket(x, y int) {
+	for _, hit := range ui.marketHits {
+		if y == hit.y && x >= hit.x && x < hit.x+hit.w {
+			ui.openChart(hit.ticker)
+			return
+		}
+	}
+}
+
+// scrollStocks scrolls the list by delta rows, keeping the selection in view
+func (ui *Ui) scrollStocks(delta int) {
+	ui.scrollList(ui.zerothQuote + delta)
+}
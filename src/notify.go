@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+type alertChannel string
+
+const (
+	CHANNEL_EXEC    alertChannel = "exec"    // run Notifiers.Exec with the alert on stdin
+	CHANNEL_WEBHOOK alertChannel = "webhook" // POST the alert to Notifiers.Webhook
+	CHANNEL_NOTIFY  alertChannel = "notify"  // desktop notification with notify-send
+)
+
+const notifyTimeout = 10 * time.Second
+
+// notifierConfig is the profile section configuring the delivery channels
+type notifierConfig struct {
+	Exec    string // shell command run for the exec channel
+	Webhook string // URL for the webhook channel
+}
+
+// alertPayload is the JSON sent to the exec and webhook channels
+type alertPayload struct {
+	Ticker    string    `json:"ticker"`
+	Rule      string    `json:"rule"`
+	Kind      alertKind `json:"kind"`
+	Value     float64   `json:"value"`
+	Last      float64   `json:"last"`
+	Change    float64   `json:"change"`
+	ChangePct float64   `json:"changePercent"`
+	Volume    float64   `json:"volume"`
+	Time      time.Time `json:"time"`
+}
+
+// notifier delivers fired alerts to the channels of their rule in the
+// background and records every delivery in a log next to the profile
+type notifier struct {
+	config  *notifierConfig
+	logPath string
+	client  *http.Client
+	logLock sync.Mutex
+}
+
+func newNotifier(profile *profile) *notifier {
+	return &notifier{
+		config:  &profile.Notifiers,
+		logPath: path.Join(path.Dir(profile.filepath), "alerts.log"),
+		client:  &http.Client{Timeout: notifyTimeout},
+	}
+}
+
+func parseAlertChannels(s string) ([]alertChannel, error) {
+	channels := []alertChannel{}
+	for _, name := range strings.Split(s, ",") {
+		channel := alertChannel(strings.ToLower(strings.TrimSpace(name)))
+		switch channel {
+		case CHANNEL_EXEC, CHANNEL_WEBHOOK, CHANNEL_NOTIFY:
+			channels = append(channels, channel)
+		default:
+			return nil, fmt.Errorf("unknown channel '%s'", name)
+		}
+	}
+	return channels, nil
+}
+
+func newAlertPayload(alert firedAlert) alertPayload {
+	return alertPayload{
+		Ticker:    alert.rule.Ticker,
+		Rule:      alert.rule.String(),
+		Kind:      alert.rule.Kind,
+		Value:     alert.rule.Value,
+		Last:      alert.quote.LastTrade,
+		Change:    alert.quote.Change,
+		ChangePct: alert.quote.ChangePct,
+		Volume:    alert.quote.Volume,
+		Time:      alert.rule.LastFired,
+	}
+}
+
+// Deliver sends the alert to each channel of its rule without blocking the ui
+func (n *notifier) Deliver(alert firedAlert) {
+	payload := newAlertPayload(alert)
+	for _, channel := range alert.rule.Channels {
+		// a copy, as :notify may change the config while this is delivered
+		go func(channel alertChannel, config notifierConfig) {
+			n.log(channel, payload, n.send(channel, config, payload))
+		}(channel, *n.config)
+	}
+}
+
+func (n *notifier) send(channel alertChannel, config notifierConfig,
+	payload alertPayload) error {
+
+	switch channel {
+	case CHANNEL_EXEC:
+		return n.sendExec(config, payload)
+	case CHANNEL_WEBHOOK:
+		return n.sendWebhook(config, payload)
+	case CHANNEL_NOTIFY:
+		return n.sendDesktop(payload)
+	}
+	return fmt.Errorf("unknown channel '%s'", channel)
+}
+
+func (n *notifier) sendExec(config notifierConfig, payload alertPayload) error {
+	if config.Exec == "" {
+		return fmt.Errorf("no command set, use :notify exec <command>")
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", config.Exec)
+	cmd.Stdin = bytes.NewReader(data)
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (n *notifier) sendWebhook(config notifierConfig, payload alertPayload) error {
+	if config.Webhook == "" {
+		return fmt.Errorf("no url set, use :notify webhook <url>")
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	response, err := n.client.Post(config.Webhook, "application/json",
+		bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", response.Status)
+	}
+	return nil
+}
+
+func (n *notifier) sendDesktop(payload alertPayload) error {
+	body := fmt.Sprintf("%s (last %.2f, %+.2f%%)", payload.Rule, payload.Last,
+		payload.ChangePct)
+	return exec.Command("notify-send", "monmop: "+payload.Ticker, body).Run()
+}
+
+// log appends the outcome of a delivery to the delivery log
+func (n *notifier) log(channel alertChannel, payload alertPayload, err error) {
+	n.logLock.Lock()
+	defer n.logLock.Unlock()
+
+	status := "ok"
+	if err != nil {
+		status = "error: " + err.Error()
+	}
+
+	file, ferr := os.OpenFile(n.logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if ferr != nil {
+		return
+	}
+	defer file.Close()
+
+	fmt.Fprintf(file, "%s\t%s\t%s\t%s\n", time.Now().Format(time.RFC3339),
+		channel, payload.Rule, status)
+}
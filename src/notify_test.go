@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testNotifier is a notifier with a profile in a directory of its own,
+// removed after the test
+func testNotifier(t *testing.T) (*notifier, *profile) {
+	dir, err := ioutil.TempDir("", "monmop")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	profile := &profile{filepath: filepath.Join(dir, "monmoprc")}
+	return newNotifier(profile), profile
+}
+
+func testPayload() alertPayload {
+	return alertPayload{Ticker: "AAPL", Rule: "AAPL above 200", Kind: ALERT_ABOVE,
+		Value: 200, Last: 201.5}
+}
+
+func TestSendExecPassesThePayloadOnStdin(t *testing.T) {
+	n, profile := testNotifier(t)
+	out := filepath.Join(filepath.Dir(profile.filepath), "out.json")
+
+	err := n.sendExec(notifierConfig{Exec: "cat > " + out}, testPayload())
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadFile(out)
+	require.NoError(t, err)
+	var got alertPayload
+	require.NoError(t, json.Unmarshal(data, &got))
+	assert.Equal(t, "AAPL", got.Ticker)
+	assert.Equal(t, 201.5, got.Last)
+}
+
+func TestSendExecErrors(t *testing.T) {
+	n, _ := testNotifier(t)
+
+	err := n.sendExec(notifierConfig{}, testPayload())
+	assert.EqualError(t, err, "no command set, use :notify exec <command>")
+
+	err = n.sendExec(notifierConfig{Exec: "echo oops; exit 3"}, testPayload())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "oops")
+}
+
+func TestSendWebhook(t *testing.T) {
+	var got alertPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		if got.Ticker != "AAPL" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	n, _ := testNotifier(t)
+	require.NoError(t, n.sendWebhook(notifierConfig{Webhook: server.URL}, testPayload()))
+	assert.Equal(t, "AAPL above 200", got.Rule)
+
+	payload := testPayload()
+	payload.Ticker = "MSFT"
+	assert.EqualError(t, n.sendWebhook(notifierConfig{Webhook: server.URL}, payload),
+		"webhook returned 400 Bad Request")
+}
+
+func TestDeliverUsesTheConfigOfTheMomentItFired(t *testing.T) {
+	n, profile := testNotifier(t)
+	out := filepath.Join(filepath.Dir(profile.filepath), "out.json")
+	profile.Notifiers.Exec = "cat > " + out
+
+	rule := alertRule{Ticker: "AAPL", Kind: ALERT_ABOVE, Value: 200,
+		Channels: []alertChannel{CHANNEL_EXEC}}
+	n.Deliver(firedAlert{rule: rule, quote: Quote{Ticker: "AAPL", LastTrade: 201}})
+	// as :notify exec would while the delivery runs
+	profile.Notifiers.Exec = ""
+
+	require.Eventually(t, func() bool {
+		data, _ := ioutil.ReadFile(n.logPath)
+		return strings.Contains(string(data), "exec")
+	}, 5*time.Second, 10*time.Millisecond)
+	data, _ := ioutil.ReadFile(n.logPath)
+	assert.Contains(t, string(data), "\tok\n")
+	assert.FileExists(t, out)
+}
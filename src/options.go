@@ -0,0 +1,333 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nsf/termbox-go"
+)
+
+type optionType int
+
+const (
+	OPTION_BOOL optionType = iota
+	OPTION_DURATION
+	OPTION_LIST // comma separated values
+	OPTION_STRING
+)
+
+// option is a setting changed with :set and kept in the profile
+type option struct {
+	name  string
+	kind  optionType
+	value string // default
+	help  string
+	check func(value string) error // nil if any value of the type will do
+}
+
+var options = []option{
+	{"refresh", OPTION_DURATION, (60 * time.Second).String(),
+		"time between two fetches of the quotes",
+		atLeast(time.Second)},
+	{"debounce", OPTION_DURATION, DEFAULT_DEBOUNCE_DURATION.String(),
+		"time before a ticker can be opened in the browser again", atLeast(0)},
+	{"market", OPTION_BOOL, "true", "show the market indices above the list", nil},
+	{"markets", OPTION_LIST, strings.Join(marketTickers, ","),
+		"tickers of the market indices", nil},
+	{"theme", OPTION_STRING, "default", "colors, one of " + strings.Join(themeNames(), ", "),
+		func(value string) error {
+			if _, ok := themes[value]; !ok {
+				return fmt.Errorf("unknown theme '%s'", value)
+			}
+			return nil
+		}},
+}
+
+func atLeast(min time.Duration) func(string) error {
+	return func(value string) error {
+		d, _ := time.ParseDuration(value)
+		if d < min {
+			return fmt.Errorf("must be at least %v", min)
+		}
+		return nil
+	}
+}
+
+func findOption(name string) *option {
+	for id := range options {
+		if options[id].name == name {
+			return &options[id]
+		}
+	}
+	return nil
+}
+
+// parse checks value and returns it the way it is stored
+func (opt *option) parse(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	switch opt.kind {
+	case OPTION_BOOL:
+		switch strings.ToLower(value) {
+		case "on", "yes":
+			value = "true"
+		case "off", "no":
+			value = "false"
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("%s is on or off, not '%s'", opt.name, value)
+		}
+		value = strconv.FormatBool(b)
+	case OPTION_DURATION:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return "", fmt.Errorf("%s is a duration such as 15s, not '%s'", opt.name,
+				value)
+		}
+		value = d.String()
+	case OPTION_LIST:
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, strings.ToUpper(item))
+			}
+		}
+		value = strings.Join(items, ",")
+	}
+	if opt.check != nil {
+		if err := opt.check(value); err != nil {
+			return "", fmt.Errorf("%s %v", opt.name, err)
+		}
+	}
+	return value, nil
+}
+
+// checkOptions runs the options read from the profile file through the
+// checks of :set. Those that fail are dropped, which leaves them at their
+// default, and returned as errors.
+func (profile *profile) checkOptions() []error {
+	names := []string{}
+	for name := range profile.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	errs := []error{}
+	for _, name := range names {
+		opt := findOption(name)
+		if opt == nil {
+			delete(profile.Options, name)
+			errs = append(errs, fmt.Errorf("unknown option '%s' in the profile", name))
+			continue
+		}
+		if err := profile.setOption(opt, profile.Options[name]); err != nil {
+			delete(profile.Options, name)
+			errs = append(errs, fmt.Errorf("%v, using %s", err,
+				profile.showOption(opt)))
+		}
+	}
+	return errs
+}
+
+// option returns the value of the option called name, its default if it
+// wasn't set
+func (profile *profile) option(name string) string {
+	if value, ok := profile.Options[name]; ok {
+		return value
+	}
+	return findOption(name).value
+}
+
+func (profile *profile) boolOption(name string) bool {
+	b, _ := strconv.ParseBool(profile.option(name))
+	return b
+}
+
+func (profile *profile) durationOption(name string) time.Duration {
+	d, _ := time.ParseDuration(profile.option(name))
+	return d
+}
+
+func (profile *profile) listOption(name string) []string {
+	if value := profile.option(name); value != "" {
+		return strings.Split(value, ",")
+	}
+	return []string{}
+}
+
+// setOption sets the option called name, only values other than the default
+// are stored
+func (profile *profile) setOption(opt *option, value string) error {
+	value, err := opt.parse(value)
+	if err != nil {
+		return err
+	}
+	if profile.Options == nil {
+		profile.Options = map[string]string{}
+	}
+	if value == opt.value {
+		delete(profile.Options, opt.name)
+	} else {
+		profile.Options[opt.name] = value
+	}
+	return nil
+}
+
+// showOption returns how :set shows the option called name
+func (profile *profile) showOption(opt *option) string {
+	if opt.kind == OPTION_BOOL {
+		if profile.boolOption(opt.name) {
+			return opt.name
+		}
+		return "no" + opt.name
+	}
+	return opt.name + "=" + profile.option(opt.name)
+}
+
+// setOptions runs :set, which takes words such as refresh=15s, nomarket,
+// market! to toggle, theme? to show and refresh& to reset. With no words
+// or ? it shows every option.
+func (editor *LineEditor) setOptions(args []string) {
+	if len(args) == 0 || len(args) == 1 && args[0] == "?" {
+		shown := []string{}
+		for id := range options {
+			shown = append(shown, editor.profile.showOption(&options[id]))
+		}
+		editor.message = strings.Join(shown, "  ")
+		return
+	}
+
+	shown := []string{}
+	for _, arg := range args {
+		name, value := arg, ""
+		assign := false
+		if i := strings.IndexAny(arg, "=:"); i >= 0 {
+			name, value, assign = arg[:i], arg[i+1:], true
+		}
+
+		opt := findOption(strings.TrimRight(name, "?!&"))
+		if opt == nil && strings.HasPrefix(name, "no") && !assign {
+			if opt = findOption(name[2:]); opt != nil && opt.kind == OPTION_BOOL {
+				name, value, assign = opt.name, "false", true
+			} else {
+				opt = nil
+			}
+		}
+		if opt == nil {
+			editor.PrintErrorf("unknown option '%s'", strings.TrimRight(name, "?!&"))
+			return
+		}
+
+		var err error
+		switch {
+		case assign:
+			err = editor.profile.setOption(opt, value)
+		case strings.HasSuffix(name, "?"):
+			shown = append(shown, editor.profile.showOption(opt))
+			continue
+		case strings.HasSuffix(name, "&"):
+			err = editor.profile.setOption(opt, opt.value)
+		case strings.HasSuffix(name, "!") && opt.kind == OPTION_BOOL:
+			err = editor.profile.setOption(opt,
+				strconv.FormatBool(!editor.profile.boolOption(opt.name)))
+		case opt.kind == OPTION_BOOL:
+			err = editor.profile.setOption(opt, "true")
+		default:
+			// like vim, :set name shows options that aren't switches
+			shown = append(shown, editor.profile.showOption(opt))
+			continue
+		}
+		if err != nil {
+			editor.PrintErrorf("%v", err)
+			return
+		}
+		shown = append(shown, editor.profile.showOption(opt))
+	}
+	editor.message = strings.Join(shown, "  ")
+}
+
+// completeOption completes the names of the options, and the themes after
+// theme=
+func completeOption(editor *LineEditor, line string, arg int) (int, []string, string) {
+	start := argStart(line, arg)
+	if strings.HasPrefix(line[start:], "theme=") {
+		return start + len("theme="), themeNames(), ""
+	}
+	names := []string{}
+	for _, opt := range options {
+		if opt.kind == OPTION_BOOL {
+			names = append(names, opt.name, "no"+opt.name)
+		} else {
+			names = append(names, opt.name+"=")
+		}
+	}
+	return start, names, ""
+}
+
+// optionHelp describes the options for the help
+func optionHelp() []helpEntry {
+	entries := []helpEntry{}
+	for _, opt := range options {
+		keys := opt.name + "=" + opt.value
+		switch opt.kind {
+		case OPTION_BOOL:
+			keys = opt.name
+		case OPTION_LIST:
+			keys = opt.name + "=a,b,..."
+		}
+		entries = append(entries, helpEntry{keys, "", opt.help})
+	}
+	return entries
+}
+
+// theme are the colors things are drawn in
+type theme struct {
+	up, down, flat         termbox.Attribute // gains, losses and no change
+	selectedFg, selectedBg termbox.Attribute // selected row, label or candidate
+	visualBg               termbox.Attribute // rows of the VISUAL selection
+	alertBg                termbox.Attribute // rows with a triggered alert
+	label                  termbox.Attribute // names of the market indices, tags
+	errorFg, errorBg       termbox.Attribute
+}
+
+var themes = map[string]theme{
+	"default": {
+		up: termbox.ColorGreen, down: termbox.ColorRed, flat: termbox.ColorBlue,
+		selectedFg: termbox.ColorBlack, selectedBg: termbox.ColorWhite,
+		visualBg: termbox.ColorCyan, alertBg: termbox.ColorYellow,
+		label:   termbox.ColorYellow,
+		errorFg: termbox.ColorRed, errorBg: termbox.ColorWhite,
+	},
+	// for terminals with the Solarized palette, whose black and white are
+	// the dark and light backgrounds
+	"solarized": {
+		up: termbox.ColorGreen, down: termbox.ColorRed, flat: termbox.ColorCyan,
+		selectedFg: termbox.ColorWhite, selectedBg: termbox.ColorBlue,
+		visualBg: termbox.ColorMagenta, alertBg: termbox.ColorYellow,
+		label:   termbox.ColorBlue,
+		errorFg: termbox.ColorWhite, errorBg: termbox.ColorRed,
+	},
+	// gains and losses that don't rely on telling red from green
+	"colorblind": {
+		up: termbox.ColorBlue, down: termbox.ColorYellow, flat: termbox.ColorDefault,
+		selectedFg: termbox.ColorBlack, selectedBg: termbox.ColorWhite,
+		visualBg: termbox.ColorCyan, alertBg: termbox.ColorMagenta,
+		label:   termbox.ColorCyan,
+		errorFg: termbox.ColorBlack, errorBg: termbox.ColorYellow,
+	},
+}
+
+// colors is the theme in use
+var colors = themes["default"]
+
+func themeNames() []string {
+	names := []string{}
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
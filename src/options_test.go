@@ -0,0 +1,112 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetOptions(t *testing.T) {
+	for _, test := range []struct {
+		args    []string
+		message string
+		stored  map[string]string
+	}{
+		{[]string{"refresh=15s"}, "refresh=15s", map[string]string{"refresh": "15s"}},
+		{[]string{"refresh:2m"}, "refresh=2m0s", map[string]string{"refresh": "2m0s"}},
+		{[]string{"refresh=60s"}, "refresh=1m0s", map[string]string{}},
+		{[]string{"nomarket"}, "nomarket", map[string]string{"market": "false"}},
+		{[]string{"market!"}, "nomarket", map[string]string{"market": "false"}},
+		{[]string{"market=off"}, "nomarket", map[string]string{"market": "false"}},
+		{[]string{"markets=dji, ixic"}, "markets=DJI,IXIC",
+			map[string]string{"markets": "DJI,IXIC"}},
+		{[]string{"theme=solarized", "refresh?"}, "theme=solarized  refresh=1m0s",
+			map[string]string{"theme": "solarized"}},
+		{[]string{"refresh"}, "refresh=1m0s", nil},
+	} {
+		editor := testEditor()
+		editor.setOptions(test.args)
+		assert.Equal(t, "", editor.promptError, test.args)
+		assert.Equal(t, test.message, editor.message, test.args)
+		assert.Equal(t, test.stored, editor.profile.Options, test.args)
+	}
+}
+
+func TestSetOptionsReset(t *testing.T) {
+	editor := testEditor()
+	editor.profile.Options = map[string]string{"refresh": "15s", "market": "false"}
+	editor.setOptions([]string{"refresh&", "market&"})
+	assert.Equal(t, "refresh=1m0s  market", editor.message)
+	assert.Empty(t, editor.profile.Options)
+}
+
+func TestSetOptionsShowsAll(t *testing.T) {
+	editor := testEditor()
+	editor.profile.Options = map[string]string{"refresh": "15s"}
+	editor.RunCommand("set?")
+	assert.Equal(t, "", editor.promptError)
+	assert.Equal(t, "refresh=15s  debounce=100ms  market  markets="+
+		strings.Join(marketTickers, ",")+"  theme=default", editor.message)
+}
+
+func TestSetOptionsErrors(t *testing.T) {
+	for _, test := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"speed=1"}, "unknown option 'speed'"},
+		{[]string{"norefresh"}, "unknown option 'norefresh'"},
+		{[]string{"refresh=soon"}, "refresh is a duration such as 15s, not 'soon'"},
+		{[]string{"refresh=0s"}, "refresh must be at least 1s"},
+		{[]string{"debounce=-1s"}, "debounce must be at least 0s"},
+		{[]string{"market=maybe"}, "market is on or off, not 'maybe'"},
+		{[]string{"theme=pink"}, "theme unknown theme 'pink'"},
+	} {
+		editor := testEditor()
+		editor.setOptions(test.args)
+		assert.Equal(t, test.err, editor.promptError, test.args)
+		assert.Empty(t, editor.profile.Options, test.args)
+	}
+}
+
+func TestCheckOptions(t *testing.T) {
+	profile := &profile{Options: map[string]string{
+		"refresh":  "0s",
+		"debounce": "soon",
+		"theme":    "pink",
+		"speed":    "1",
+		"market":   "off",
+		"markets":  "dji, ixic",
+	}}
+	errs := profile.checkOptions()
+
+	msgs := []string{}
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	assert.Equal(t, []string{
+		"debounce is a duration such as 15s, not 'soon', using debounce=100ms",
+		"refresh must be at least 1s, using refresh=1m0s",
+		"unknown option 'speed' in the profile",
+		"theme unknown theme 'pink', using theme=default",
+	}, msgs)
+
+	// the bad values fall back to their default, the others are kept
+	assert.Equal(t, map[string]string{"market": "false", "markets": "DJI,IXIC"},
+		profile.Options)
+	assert.Equal(t, time.Minute, profile.durationOption("refresh"))
+	assert.Equal(t, "default", profile.option("theme"))
+}
+
+func TestCheckOptionsValid(t *testing.T) {
+	profile := &profile{Options: map[string]string{"refresh": "15s", "theme": "solarized"}}
+	assert.Empty(t, profile.checkOptions())
+	assert.Equal(t, 15*time.Second, profile.durationOption("refresh"))
+
+	// stored as the default, which needn't be stored
+	profile.Options = map[string]string{"refresh": "60s"}
+	assert.Empty(t, profile.checkOptions())
+	assert.Empty(t, profile.Options)
+}
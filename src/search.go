@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+)
+
+// columns the search looks in, by the name of the column showing them
+var searchColumns = []string{"Ticker", "Name", "Notes", "Tags"}
+
+// search is the pattern of the last / or * search, kept for n and N and to
+// highlight the matches
+type search struct {
+	pattern string
+	word    bool // match whole words only, as with *
+	origin  int  // row selected before the search started
+}
+
+// fuzzyMatch finds the runes of pattern in text in order, ignoring case.
+// It returns the positions of the runes matched in text and a score that
+// favours runes next to each other and at the start of words, ok is false
+// if text doesn't contain pattern.
+func fuzzyMatch(pattern, text string) (score int, positions []int, ok bool) {
+	p := []rune(strings.ToLower(pattern))
+	t := []rune(text)
+	if len(p) == 0 {
+		return 0, nil, false
+	}
+
+	// the best match starting at each place the first rune is found
+	best := -1
+	for start := range t {
+		if unicode.ToLower(t[start]) != p[0] {
+			continue
+		}
+		matched := []int{start}
+		s := wordStartBonus(t, start)
+		for i := start + 1; i < len(t) && len(matched) < len(p); i++ {
+			if unicode.ToLower(t[i]) != p[len(matched)] {
+				continue
+			}
+			if i == matched[len(matched)-1]+1 {
+				s += 5
+			} else {
+				s -= i - matched[len(matched)-1] - 1
+			}
+			s += wordStartBonus(t, i)
+			matched = append(matched, i)
+		}
+		if len(matched) == len(p) && (best < 0 || s > score) {
+			best, score, positions = start, s, matched
+		}
+	}
+	return score, positions, best >= 0
+}
+
+// wordStartBonus favours runes starting a word, e.g. the M of "Meta" or
+// of "FooMeta"
+func wordStartBonus(t []rune, i int) int {
+	if i == 0 || !unicode.IsLetter(t[i-1]) && !unicode.IsDigit(t[i-1]) ||
+		unicode.IsLower(t[i-1]) && unicode.IsUpper(t[i]) {
+		return 8
+	}
+	return 0
+}
+
+// wordMatch returns the positions of the first whole word of text that is
+// word, ignoring case
+func wordMatch(word, text string) ([]int, bool) {
+	t := []rune(text)
+	w := []rune(word)
+	// symbols such as BRK.B or ^GSPC are words, a full stop after one isn't
+	inWord := func(i int) bool {
+		if i < 0 || i >= len(t) {
+			return false
+		}
+		if unicode.IsLetter(t[i]) || unicode.IsDigit(t[i]) {
+			return true
+		}
+		return strings.ContainsRune(".-^=", t[i]) && i+1 < len(t) &&
+			(unicode.IsLetter(t[i+1]) || unicode.IsDigit(t[i+1]))
+	}
+	for start := 0; start+len(w) <= len(t); start++ {
+		if inWord(start-1) || inWord(start+len(w)) {
+			continue
+		}
+		if strings.EqualFold(string(t[start:start+len(w)]), word) {
+			positions := make([]int, len(w))
+			for i := range positions {
+				positions[i] = start + i
+			}
+			return positions, true
+		}
+	}
+	return nil, false
+}
+
+// match returns the positions of the pattern in text
+func (s *search) match(text string) ([]int, bool) {
+	if s.word {
+		return wordMatch(s.pattern, text)
+	}
+	_, positions, ok := fuzzyMatch(s.pattern, text)
+	return positions, ok
+}
+
+// searchText is what the search looks at in column name of q
+func (ui *Ui) searchText(column string, q Quote) string {
+	switch column {
+	case "Ticker":
+		return q.Ticker
+	case "Name":
+		return q.Name
+	case "Notes":
+		return ui.noteOf(q.Ticker)
+	case "Tags":
+		return strings.Join(ui.tagsOf(q.Ticker), ",")
+	}
+	return ""
+}
+
+// searchScore scores how well q matches the search, ok is false if it
+// doesn't match. A match on the ticker wins over the other fields.
+func (ui *Ui) searchScore(q Quote) (best int, ok bool) {
+	for id, column := range searchColumns {
+		text := ui.searchText(column, q)
+		score := 0
+		if ui.search.word {
+			if _, found := wordMatch(ui.search.pattern, text); !found {
+				continue
+			}
+		} else {
+			var found bool
+			if score, _, found = fuzzyMatch(ui.search.pattern, text); !found {
+				continue
+			}
+		}
+		if id == 0 {
+			score += 50
+			if strings.EqualFold(text, ui.search.pattern) {
+				score += 100
+			}
+		}
+		if !ok || score > best {
+			best, ok = score, true
+		}
+	}
+	return best, ok
+}
+
+// searchMatches returns the rows matching the search in list order
+func (ui *Ui) searchMatches() []int {
+	rows := []int{}
+	if ui.search.pattern == "" || ui.stockQuotes == nil {
+		return rows
+	}
+	for id, q := range *ui.stockQuotes {
+		if _, ok := ui.searchScore(q); ok {
+			rows = append(rows, id)
+		}
+	}
+	return rows
+}
+
+// StartSearch remembers the selected row and the last search to go back to
+// if the search is cancelled
+func (ui *Ui) StartSearch() {
+	ui.lastSearch = ui.search
+	ui.search = search{origin: ui.selectedQuote}
+}
+
+// searchAsTyped selects the best match of the pattern typed so far, the
+// first one from the row the search started on if several are as good
+func (ui *Ui) searchAsTyped(pattern string) {
+	ui.search.pattern = strings.TrimSpace(pattern)
+	ui.search.word = false
+
+	best, row := 0, -1
+	for _, id := range ui.searchMatches() {
+		score, _ := ui.searchScore((*ui.stockQuotes)[id])
+		if row < 0 || score > best || score == best && row < ui.search.origin &&
+			id >= ui.search.origin {
+			best, row = score, id
+		}
+	}
+	if row < 0 {
+		row = ui.search.origin
+	}
+	ui.selectQuote(row)
+}
+
+// CancelSearch goes back to the row selected before the search
+func (ui *Ui) CancelSearch() {
+	origin := ui.search.origin
+	ui.search = ui.lastSearch
+	ui.selectQuote(origin)
+}
+
+// searchNext selects the count-th match after the selected row, or before
+// it if backward is set, wrapping around the list
+func (ui *Ui) searchNext(count int, backward bool) {
+	if ui.search.pattern == "" {
+		ui.lineEditor.PrintErrorf("no previous search")
+		return
+	}
+	rows := ui.searchMatches()
+	if len(rows) == 0 {
+		ui.lineEditor.PrintErrorf("no match for '%s'", ui.search.pattern)
+		return
+	}
+
+	// the match at or after the selection
+	at := 0
+	for at < len(rows) && rows[at] < ui.selectedQuote {
+		at++
+	}
+	if backward {
+		at = ((at-count)%len(rows) + len(rows)) % len(rows)
+	} else {
+		if at < len(rows) && rows[at] == ui.selectedQuote {
+			at++
+		}
+		at = (at + count - 1) % len(rows)
+	}
+	ui.selectQuote(rows[at])
+	ui.lineEditor.message = fmt.Sprintf("/%s [%d/%d]", ui.search.pattern, at+1,
+		len(rows))
+}
+
+// searchWord searches for the ticker of the selected row as a word, so that
+// notes and tags mentioning it match too
+func (ui *Ui) searchWord(count int) {
+	if ui.stockQuotes == nil || len(*ui.stockQuotes) == 0 {
+		return
+	}
+	ui.search = search{
+		pattern: (*ui.stockQuotes)[ui.selectedQuote].Ticker,
+		word:    true,
+		origin:  ui.selectedQuote,
+	}
+	ui.searchNext(count, false)
+}
+
+// drawMatches highlights the runes of the cell of column matching the
+// search, the cell being drawn at x on row y
+func (ui *Ui) drawMatches(x, y int, col *Column, q Quote, fg, bg termbox.Attribute) {
+	if ui.search.pattern == "" {
+		return
+	}
+	searched := false
+	for _, name := range searchColumns {
+		searched = searched || name == col.name
+	}
+	if !searched {
+		return
+	}
+
+	text := []rune(ui.searchText(col.name, q))
+	positions, ok := ui.search.match(string(text))
+	if !ok {
+		return
+	}
+	for _, p := range positions {
+		offset := runewidth.StringWidth(string(text[:p]))
+		if offset >= col.width-1 {
+			break
+		}
+		ui.stockWin.print(x+offset, y, fg|termbox.AttrBold|termbox.AttrUnderline,
+			bg, string(text[p]))
+	}
+}
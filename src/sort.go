@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// sortKey is one column of a sort spec, the first key is compared first and
+// the later ones break its ties
+type sortKey struct {
+	Column     string
+	Descending bool `json:",omitempty"`
+}
+
+func (key sortKey) String() string {
+	if key.Descending {
+		return key.Column + " desc"
+	}
+	return key.Column + " asc"
+}
+
+// formatSortSpec renders a spec the way parseSortSpec reads it
+func formatSortSpec(spec []sortKey) string {
+	if len(spec) == 0 {
+		return "manual order"
+	}
+	keys := make([]string, len(spec))
+	for id, key := range spec {
+		keys[id] = key.String()
+	}
+	return strings.Join(keys, ", ")
+}
+
+// parseSortSpec parses a comma separated list of columns, each optionally
+// followed by asc or desc, e.g. "Chg %, Volume desc". Column names are
+// matched against settings and returned as they are spelled there.
+func parseSortSpec(s string, settings []columnSetting) ([]sortKey, error) {
+	spec := []sortKey{}
+	for _, part := range strings.Split(s, ",") {
+		words := strings.Fields(part)
+		if len(words) == 0 {
+			continue
+		}
+		key := sortKey{}
+		switch strings.ToLower(words[len(words)-1]) {
+		case "desc":
+			key.Descending = true
+			words = words[:len(words)-1]
+		case "asc":
+			words = words[:len(words)-1]
+		}
+
+		name := strings.Join(words, " ")
+		id := findColumn(settings, name)
+		if id < 0 {
+			return nil, fmt.Errorf("no column named '%s'", name)
+		}
+		key.Column = settings[id].Name
+		spec = setSortKey(spec, key, true)
+	}
+	if len(spec) == 0 {
+		return nil, fmt.Errorf("usage: sort <column> [asc|desc][, ...] | manual")
+	}
+	return spec, nil
+}
+
+func findSortKey(spec []sortKey, column string) int {
+	for id, key := range spec {
+		if key.Column == column {
+			return id
+		}
+	}
+	return -1
+}
+
+// setSortKey returns spec sorting by key alone, or with key appended after
+// the other keys if then is set. A column already in spec keeps its place
+// and takes the new direction.
+func setSortKey(spec []sortKey, key sortKey, then bool) []sortKey {
+	if !then {
+		return []sortKey{key}
+	}
+	result := append([]sortKey{}, spec...)
+	if id := findSortKey(result, key.Column); id >= 0 {
+		result[id].Descending = key.Descending
+		return result
+	}
+	return append(result, key)
+}
+
+// removeSortKey returns spec without column
+func removeSortKey(spec []sortKey, column string) []sortKey {
+	result := []sortKey{}
+	for _, key := range spec {
+		if key.Column != column {
+			result = append(result, key)
+		}
+	}
+	return result
+}
+
+// sortQuotes orders quotes by spec, then by their position in the manual
+// order of tickers. Columns of spec missing from the layout are ignored.
+func sortQuotes(quotes []Quote, spec []sortKey, layout *Layout,
+	tickers []string) {
+
+	manual := make(map[string]int, len(tickers))
+	for id, ticker := range tickers {
+		if _, ok := manual[strings.ToUpper(ticker)]; !ok {
+			manual[strings.ToUpper(ticker)] = id
+		}
+	}
+
+	columns := []*Column{}
+	descending := []bool{}
+	for _, key := range spec {
+		for id := range layout.all {
+			if layout.all[id].name == key.Column {
+				columns = append(columns, &layout.all[id])
+				descending = append(descending, key.Descending)
+				break
+			}
+		}
+	}
+
+	// the values are computed once per quote rather than per comparison
+	type row struct {
+		quote  Quote
+		values []interface{}
+		manual int
+	}
+	rows := make([]row, len(quotes))
+	for id, q := range quotes {
+		rows[id] = row{quote: q, values: make([]interface{}, len(columns)),
+			manual: manual[strings.ToUpper(q.Ticker)]}
+		for k, col := range columns {
+			rows[id].values[k] = col.value(q)
+		}
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		for k, col := range columns {
+			a, b := rows[i].values[k], rows[j].values[k]
+			if descending[k] {
+				a, b = b, a
+			}
+			if col.less(a, b) {
+				return true
+			}
+			if col.less(b, a) {
+				return false
+			}
+		}
+		return rows[i].manual < rows[j].manual
+	})
+	for id := range rows {
+		quotes[id] = rows[id].quote
+	}
+}
+
+// moveTickers moves every ticker of the selection one place up (delta -1) or
+// down (delta 1) in shown, jumping over the neighbour that isn't selected.
+// Selected tickers already at the edge or next to each other move as a
+// block.
+func moveTickers(shown []string, selected map[string]bool, delta int) []string {
+	result := append([]string{}, shown...)
+	if delta < 0 {
+		for i := 1; i < len(result); i++ {
+			if selected[result[i]] && !selected[result[i-1]] {
+				result[i], result[i-1] = result[i-1], result[i]
+			}
+		}
+	} else {
+		for i := len(result) - 2; i >= 0; i-- {
+			if selected[result[i]] && !selected[result[i+1]] {
+				result[i], result[i+1] = result[i+1], result[i]
+			}
+		}
+	}
+	return result
+}
+
+// reorderTickers puts the tickers of shown in their new order into the
+// places they take in tickers, leaving the tickers that aren't shown, e.g.
+// hidden by the list filter, where they are
+func reorderTickers(tickers []string, shown []string) []string {
+	isShown := make(map[string]bool, len(shown))
+	for _, ticker := range shown {
+		isShown[strings.ToUpper(ticker)] = true
+	}
+
+	result := append([]string{}, tickers...)
+	next := 0
+	for id, ticker := range result {
+		if isShown[strings.ToUpper(ticker)] && next < len(shown) {
+			result[id] = shown[next]
+			next++
+		}
+	}
+	return result
+}
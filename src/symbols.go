@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// most suggestions given for an unknown symbol
+const maxSuggestions = 3
+
+// most unknown symbols the provider is asked suggestions for at once
+const maxLookups = 3
+
+// fetchSymbols searches the provider, replaced in the tests
+var fetchSymbols = FetchSymbols
+
+// symbols such as AAPL, BRK.B and 0700.HK (exchange suffix), ^GSPC (index),
+// EURUSD=X (currency), GC=F (future) and BTC-USD (crypto)
+var symbolFmt = regexp.MustCompile(`^\^?[A-Z0-9]+([.-][A-Z0-9]+)*(=[XF])?$`)
+
+func validSymbol(symbol string) bool {
+	return len(symbol) <= 20 && symbolFmt.MatchString(symbol)
+}
+
+// parseSymbols splits input into symbols separated by commas or spaces,
+// in upper case
+func parseSymbols(input string) ([]string, error) {
+	symbols := []string{}
+	for _, field := range strings.FieldsFunc(input, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	}) {
+		symbol := strings.ToUpper(field)
+		if !validSymbol(symbol) {
+			return nil, fmt.Errorf("'%s' is not a ticker symbol", field)
+		}
+		symbols = append(symbols, symbol)
+	}
+	if len(symbols) == 0 {
+		return nil, fmt.Errorf("no ticker given")
+	}
+	return symbols, nil
+}
+
+// suggestSymbols returns symbols symbol may be a typo of: the known ones a
+// letter or two away, then those the provider found
+func suggestSymbols(symbol string, known []string, found []string) []string {
+	suggestions := []string{}
+	add := func(s string) {
+		s = strings.ToUpper(s)
+		if s == symbol || len(suggestions) >= maxSuggestions {
+			return
+		}
+		for _, suggestion := range suggestions {
+			if suggestion == s {
+				return
+			}
+		}
+		suggestions = append(suggestions, s)
+	}
+
+	for distance := 1; distance <= 2; distance++ {
+		for _, k := range known {
+			if editDistance(symbol, k) == distance {
+				add(k)
+			}
+		}
+	}
+	for _, s := range found {
+		add(s)
+	}
+	return suggestions
+}
+
+// unknownSymbols describes the symbols the provider doesn't know, with
+// suggestions for each
+func unknownSymbols(symbols []string, known []string) error {
+	// the search of the provider is lenient about the exchange suffix and
+	// finds companies by name, so that "APPLE" gives AAPL. It is asked about
+	// the first few symbols only, all at once, so that a typo doesn't keep
+	// the keys waiting for long.
+	found := make([][]string, len(symbols))
+	var wg sync.WaitGroup
+	for id, symbol := range symbols {
+		if id >= maxLookups {
+			break
+		}
+		wg.Add(1)
+		go func(id int, symbol string) {
+			defer wg.Done()
+			found[id], _ = fetchSymbols(symbol)
+		}(id, symbol)
+	}
+	wg.Wait()
+
+	described := []string{}
+	for id, symbol := range symbols {
+		if suggestions := suggestSymbols(symbol, known, found[id]); len(suggestions) > 0 {
+			described = append(described, fmt.Sprintf("%s (did you mean %s?)", symbol,
+				strings.Join(suggestions, ", ")))
+		} else {
+			described = append(described, symbol)
+		}
+	}
+	if len(symbols) == 1 {
+		return fmt.Errorf("unknown ticker %s", described[0])
+	}
+	return fmt.Errorf("unknown tickers %s", strings.Join(described, ", "))
+}
+
+// editDistance is the number of runes to insert, delete or change to turn a
+// into b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	row := make([]int, len(rb)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		diagonal := row[0]
+		row[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			next := diagonal + cost
+			if row[j]+1 < next {
+				next = row[j] + 1
+			}
+			if row[j-1]+1 < next {
+				next = row[j-1] + 1
+			}
+			diagonal, row[j] = row[j], next
+		}
+	}
+	return row[len(rb)]
+}
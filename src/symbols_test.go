@@ -0,0 +1,141 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidSymbol(t *testing.T) {
+	for _, symbol := range []string{"AAPL", "BRK.B", "0700.HK", "^GSPC", "EURUSD=X",
+		"GC=F", "BTC-USD", "RDS-A.AS", strings.Repeat("A", 20)} {
+		assert.True(t, validSymbol(symbol), symbol)
+	}
+	for _, symbol := range []string{"", "=X", "^", "A..B", "A.", ".A", "-A", "A-",
+		"AAPL=Y", "GC=F=X", "A^B", "A B", "aapl", strings.Repeat("A", 21)} {
+		assert.False(t, validSymbol(symbol), symbol)
+	}
+}
+
+func TestParseSymbols(t *testing.T) {
+	symbols, err := parseSymbols("aapl, brk.b  ^gspc,,eurusd=x\tbtc-usd")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"AAPL", "BRK.B", "^GSPC", "EURUSD=X", "BTC-USD"}, symbols)
+
+	_, err = parseSymbols("aapl a..b")
+	assert.EqualError(t, err, "'a..b' is not a ticker symbol")
+	_, err = parseSymbols(" , ")
+	assert.EqualError(t, err, "no ticker given")
+}
+
+func TestEditDistance(t *testing.T) {
+	for _, test := range []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"AAPL", "AAPL", 0},
+		{"", "AAPL", 4},
+		{"APPL", "AAPL", 1},
+		{"AAPL", "AAP", 1},
+		{"MSFT", "MFST", 2},
+		{"GOOG", "GOOGL", 1},
+		{"IBM", "TSLA", 4},
+	} {
+		assert.Equal(t, test.want, editDistance(test.a, test.b), test.a+" "+test.b)
+		assert.Equal(t, test.want, editDistance(test.b, test.a), test.b+" "+test.a)
+	}
+}
+
+func TestSuggestSymbols(t *testing.T) {
+	known := []string{"MSFT", "AAPL", "AMZN", "AAP"}
+	// the known ones a letter away first, then two letters away, then those
+	// found by the provider
+	assert.Equal(t, []string{"AAPL", "AAP", "APPLE.MX"},
+		suggestSymbols("APPL", known, []string{"aapl", "APPLE.MX", "APLE"}))
+	assert.Equal(t, []string{}, suggestSymbols("XYZW", known, nil))
+}
+
+// stubSymbols has fetchSymbols find found for every query during the test,
+// and returns the queries made
+func stubSymbols(t *testing.T, found []string) *[]string {
+	queries := []string{}
+	var mu sync.Mutex
+	fetchSymbols = func(query string) ([]string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		queries = append(queries, query)
+		return found, nil
+	}
+	t.Cleanup(func() { fetchSymbols = FetchSymbols })
+	return &queries
+}
+
+func TestUnknownSymbols(t *testing.T) {
+	queries := stubSymbols(t, []string{"AAPL"})
+	err := unknownSymbols([]string{"APPLE"}, nil)
+	assert.EqualError(t, err, "unknown ticker APPLE (did you mean AAPL?)")
+	assert.Equal(t, []string{"APPLE"}, *queries)
+
+	// the provider is asked about the first few symbols only
+	queries = stubSymbols(t, nil)
+	err = unknownSymbols([]string{"XA", "XB", "XC", "XD", "XE"}, []string{"XZ"})
+	assert.EqualError(t, err, "unknown tickers XA (did you mean XZ?), "+
+		"XB (did you mean XZ?), XC (did you mean XZ?), XD (did you mean XZ?), "+
+		"XE (did you mean XZ?)")
+	assert.ElementsMatch(t, []string{"XA", "XB", "XC"}, *queries)
+}
+
+// stubQuotes has fetchQuotes find the tickers of known during the test, and
+// returns the lists of tickers asked for
+func stubQuotes(t *testing.T, known ...string) *[][]string {
+	asked := [][]string{}
+	fetchQuotes = func(tickers []string) (*[]Quote, error) {
+		asked = append(asked, tickers)
+		quotes := []Quote{}
+		for _, ticker := range tickers {
+			if getTickerId(known, ticker) != -1 {
+				quotes = append(quotes, Quote{Ticker: ticker})
+			}
+		}
+		return &quotes, nil
+	}
+	t.Cleanup(func() { fetchQuotes = FetchQuotes })
+	return &asked
+}
+
+func TestAddQuotesDedup(t *testing.T) {
+	asked := stubQuotes(t, "AAPL", "BRK.B")
+	stubSymbols(t, nil)
+
+	editor := testEditor()
+	editor.input = "aapl, AAPL msft brk.b Aapl"
+	ticker, err := editor.AddQuotes()
+	assert.NoError(t, err)
+	assert.Equal(t, "AAPL", ticker)
+	// MSFT is in the list already and every other symbol is checked once
+	assert.Equal(t, [][]string{{"AAPL", "BRK.B"}}, *asked)
+	assert.Equal(t, []string{"MSFT", "AAPL", "BRK.B"}, editor.profile.Tickers)
+}
+
+func TestAddQuotesUnknown(t *testing.T) {
+	asked := stubQuotes(t, "AAPL")
+	stubSymbols(t, nil)
+
+	editor := testEditor()
+	editor.input = "xyzq aapl XYZQ"
+	ticker, err := editor.AddQuotes()
+	assert.EqualError(t, err, "unknown ticker XYZQ")
+	assert.Equal(t, "AAPL", ticker)
+	assert.Equal(t, [][]string{{"XYZQ", "AAPL"}}, *asked)
+	assert.Equal(t, []string{"MSFT", "AAPL"}, editor.profile.Tickers)
+
+	// nothing to check when every ticker is in the list already
+	editor.input = "msft"
+	ticker, err = editor.AddQuotes()
+	assert.NoError(t, err)
+	assert.Equal(t, "MSFT", ticker)
+	assert.Len(t, *asked, 1)
+}
@@ -1,14 +1,11 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
+	"os"
 	"os/exec"
-	"reflect"
 	"runtime"
-	"sort"
-	"strconv"
 	"strings"
 	"time"
 	"unicode/utf8"
@@ -34,10 +31,19 @@ var marketNames = map[string]string{
 	"BTC-USD":  "Bitcoin",
 }
 
+// marketName is how the market index ticker is labelled
+func marketName(ticker string) string {
+	if name, ok := marketNames[ticker]; ok {
+		return name
+	}
+	return ticker
+}
+
 const (
-	NO_CHAR         string = " "
 	DESCENDING_CHAR string = "🠗"
 	ASCENDING_CHAR  string = "🠕"
+	MORE_LEFT_CHAR  string = "«"
+	MORE_RIGHT_CHAR string = "»"
 )
 const (
 	layoutUS = "01/02/2006"
@@ -110,17 +116,35 @@ type Ui struct {
 	marketQuotes         *[]Quote
 	maxQuotesHeight      int
 	selectedLabel        int
-	sortSymbol           string
+	selectedAlert        int
+	selectedColumn       int
+	firstColumn          int // first column shown after the frozen one
 
 	mode       *mode
 	profile    *profile
 	lineEditor *LineEditor
+	notifier   *notifier
+	history    *historyCache
+	indicators *indicatorCache
+	chart      *chartView
+	compare    *compareView
+	help       *helpView
+	keymap     *keymap
+
+	search     search // last search, highlighted in the list
+	lastSearch search // search before the one being typed, back if it is cancelled
+
+	visualAnchor int    // row the VISUAL selection started on, -1 outside of it
+	pendingKeys  string // count and keys of a sequence being typed, e.g. "5z"
+
+	marketHits []marketHit // where each market index was last drawn
+	lastClick  click       // to detect double clicks
 }
 
 func newUI(profile *profile, mode *mode) *Ui {
 	wtot, htot := termbox.Size()
 
-	return &Ui{
+	ui := &Ui{
 		titleWin: &Win{
 			w: wtot,
 			h: titleWinHeight,
@@ -152,18 +176,20 @@ func newUI(profile *profile, mode *mode) *Ui {
 			x: 0,
 			y: htot - 1,
 		},
-		layout:          NewLayout(),
 		selectedQuote:   0,
 		selectedSort:    0,
 		zerothQuote:     0,
 		selectedLabel:   0,
-		sortSymbol:      NO_CHAR,
+		visualAnchor:    -1,
 		mode:            mode,
 		profile:         profile,
+		notifier:        newNotifier(profile),
+		history:         newHistoryCache(),
 		maxQuotesHeight: htot - 7,
 		lineEditor: NewLineEditor(
 			profile,
 			nil,
+			mode,
 			&Win{
 				w: wtot,
 				h: 1,
@@ -172,17 +198,31 @@ func newUI(profile *profile, mode *mode) *Ui {
 			},
 		),
 	}
+	ui.indicators = newIndicatorCache(ui.history)
+	ui.reloadLayout()
+	ui.firstColumn = ui.minFirstColumn()
 
+	return ui
 }
 
 func (ui *Ui) Resize() {
 	fg, bg := termbox.ColorDefault, termbox.ColorDefault
 	termbox.Clear(fg, bg)
+	ui.placeWins()
+	ui.Clear()
+	ui.Draw()
+}
+
+// placeWins fits the windows to the terminal, one under the other
+func (ui *Ui) placeWins() {
 	wtot, htot := termbox.Size()
 	ui.titleWin.w = wtot
 	ui.marketWin.w = wtot
+	ui.marketWin.y = ui.titleWin.y + ui.titleWin.h
 	ui.labelWin.w = wtot
+	ui.labelWin.y = ui.marketWin.y + ui.marketWin.h
 	ui.stockWin.w = wtot
+	ui.stockWin.y = ui.labelWin.y + ui.labelWin.h
 	ui.stockWin.h = htot - (ui.titleWin.h + ui.marketWin.h + ui.commandWin.h +
 		ui.labelWin.h)
 	ui.commandWin.w = wtot
@@ -197,17 +237,63 @@ func (ui *Ui) Resize() {
 	if len(ui.visibleQuotes) > ui.maxQuotesHeight {
 		ui.visibleQuotes = ui.visibleQuotes[:ui.maxQuotesHeight]
 	}
+}
 
-	ui.Clear()
-	ui.Draw()
+// applyOptions puts the :set options about drawing in effect
+func (ui *Ui) applyOptions() {
+	colors = themes[ui.profile.option("theme")]
+
+	height := 0
+	if ui.profile.boolOption("market") {
+		height = marketWinHeight
+	}
+	if height != ui.marketWin.h {
+		ui.marketWin.h = height
+		ui.placeWins()
+		termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+	}
 }
 
 func (ui *Ui) Draw() {
 	ui.drawTitleLine()
+	if *ui.mode == HELP {
+		ui.help.Draw(ui.chartWin(), ui.commandWin)
+		termbox.Flush()
+		return
+	}
+	if *ui.mode == CHART || *ui.mode == COMPARE {
+		if *ui.mode == CHART {
+			ui.chart.Draw(ui.chartWin())
+		} else {
+			ui.compare.Draw(ui.chartWin())
+		}
+		ui.drawCommandWin()
+		termbox.Flush()
+		return
+	}
 	ui.drawMarketWin()
-	ui.drawLabelWin()
-	ui.drawStockWin()
+	if *ui.mode == ALERTS || (*ui.mode == COMMAND && ui.lineEditor.cmd == 'A') {
+		ui.drawAlertsWin()
+	} else if *ui.mode == COLUMNS {
+		ui.drawColumnsWin()
+	} else {
+		// also below a short list, where completions may have been listed
+		ui.overlayWin().Clear()
+		ui.drawLabelWin()
+		ui.drawStockWin()
+	}
 	ui.drawCommandWin()
+	if *ui.mode == VISUAL {
+		first, last := ui.visualRange()
+		ui.commandWin.print(0, 0, termbox.ColorDefault|termbox.AttrBold,
+			termbox.ColorDefault, fmt.Sprintf("-- VISUAL -- %d selected  "+
+				"d delete  J/K move  t tag  y copy  c compare  e export",
+				last-first+1))
+	}
+	if ui.pendingKeys != "" {
+		ui.commandWin.print(ui.commandWin.w-len(ui.pendingKeys)-1, 0,
+			termbox.ColorDefault, termbox.ColorDefault, ui.pendingKeys)
+	}
 
 	termbox.Flush()
 }
@@ -220,57 +306,145 @@ func (ui *Ui) Clear() {
 }
 
 func (ui *Ui) Prompt(cmd rune) {
+	ui.prompt(cmd, nil)
+}
+
+// prompt opens the prompt of cmd, acting on selection when it is given
+func (ui *Ui) prompt(cmd rune, selection []string) {
 	ui.lineEditor.Done() // clear the buffer
+	ui.lineEditor.selection = selection
 	ui.lineEditor.Prompt(cmd, ui.selectedQuote)
+	if cmd == '/' {
+		ui.StartSearch()
+	}
 	ui.Draw()
 }
 
 func (ui *Ui) ExecuteCommand() {
+	// the selection was handed to the line editor with the prompt
+	ui.visualAnchor = -1
+	ui.lineEditor.Remember()
+
 	switch ui.lineEditor.cmd {
 	case 'a':
 		tickerName, err := ui.lineEditor.AddQuotes()
-		if err != nil {
-			ui.lineEditor.Done()
-			ui.lineEditor.PrintErrorf("%s is not a valid list of tickers",
-				tickerName)
-		} else {
+		ui.lineEditor.Done()
+		// the tickers that exist are added even if others don't
+		if tickerName != "" {
 			ui.GetQuotes()
 			newQ := ui.getQuoteByTicker(tickerName)
 			if newQ != nil {
 				ui.updateSelection(*newQ)
 			}
-			ui.lineEditor.Done()
+		}
+		if err != nil {
+			ui.lineEditor.PrintErrorf("%v", err)
 		}
 	case 'd':
 		oldQuoteId := ui.lineEditor.Execute(ui.selectedQuote)
+		deleted := ui.lineEditor.deleted
 		ui.lineEditor.Done()
+		if deleted > 1 {
+			ui.lineEditor.message = fmt.Sprintf("deleted %d tickers", deleted)
+		}
 		ui.stockWin.Clear()
 		ui.GetQuotes()
-		if oldQuoteId >= 0 {
+		if oldQuoteId >= 0 && oldQuoteId < len(*ui.stockQuotes) {
 			ui.updateSelection((*ui.stockQuotes)[oldQuoteId])
 		}
+	case 't', 'y':
+		ui.lineEditor.Execute(ui.selectedQuote)
+		ui.labelWin.Clear()
+		ui.stockWin.Clear()
+	case 'e':
+		path := ui.lineEditor.input
+		tickers := ui.lineEditor.selection
 		ui.lineEditor.Done()
+		if err := ui.exportSelection(path, tickers); err != nil {
+			ui.lineEditor.PrintErrorf("couldn't export: %v", err)
+		} else {
+			ui.lineEditor.message = fmt.Sprintf("exported %d tickers to %s",
+				len(tickers), strings.TrimSpace(path))
+		}
 	case '/':
-		oldQuoteId := ui.lineEditor.Execute(ui.selectedQuote)
-		tickerName := ui.lineEditor.input
+		pattern := strings.TrimSpace(ui.lineEditor.input)
 		ui.lineEditor.Done()
-		if oldQuoteId < 0 {
-			ui.lineEditor.PrintErrorf("couldn't find specified ticker(s): %s ",
-				tickerName)
-		} else {
-			ui.updateSelection((*ui.stockQuotes)[oldQuoteId])
+		// an empty search clears the highlight
+		ui.searchAsTyped(pattern)
+		if pattern != "" && len(ui.searchMatches()) == 0 {
+			ui.lineEditor.PrintErrorf("no match for '%s'", pattern)
 		}
 	case ':':
 		ui.lineEditor.Execute(ui.selectedQuote)
-		ui.stockWin.Clear()
-		ui.resetSelection()
-		ui.GetQuotes()
+		if ui.afterCommands() {
+			return
+		}
+	case 'A':
+		if ui.lineEditor.Execute(ui.selectedQuote) >= 0 {
+			ui.selectedAlert = len(ui.profile.Alerts) - 1
+			if ui.lineEditor.alertIndex >= 0 {
+				ui.selectedAlert = ui.lineEditor.alertIndex
+			}
+		}
+		*ui.mode = ALERTS
+	}
+	ui.Draw()
+}
+
+// afterCommands puts what : commands changed on the screen, it returns
+// true if they opened a view, which is drawn already
+func (ui *Ui) afterCommands() bool {
+	if *ui.mode == COMPARE {
+		ui.OpenCompare(ui.lineEditor.compareTickers)
+		return true
+	}
+	if *ui.mode == HELP {
+		ui.openHelp(NORMAL, ui.lineEditor.helpQuery)
+		return true
+	}
+	ui.reloadLayout()
+	ui.applyOptions()
+	ui.labelWin.Clear()
+	ui.stockWin.Clear()
+	ui.resetSelection()
+	ui.GetQuotes()
+	return false
+}
+
+// SourceStartup runs the startup commands of the file at path, if there is
+// one, and draws the result
+func (ui *Ui) SourceStartup(path string) bool {
+	if _, err := os.Stat(path); err != nil {
+		return false
+	}
+	ui.lineEditor.source([]string{path})
+	// only errors are worth showing at startup
+	ui.lineEditor.message = ""
+	if !ui.afterCommands() {
+		ui.Draw()
+	}
+	return true
+}
+
+// PromptAlert asks for a new alert rule, or for a replacement of the
+// selected rule when edit is set
+func (ui *Ui) PromptAlert(edit bool) {
+	ui.lineEditor.Done()
+	ui.lineEditor.Prompt('A', ui.selectedQuote)
+	ui.lineEditor.alertIndex = -1
+	if edit && ui.selectedAlert < len(ui.profile.Alerts) {
+		ui.lineEditor.alertIndex = ui.selectedAlert
+		ui.lineEditor.input = ui.profile.Alerts[ui.selectedAlert].String()
+		ui.lineEditor.cursor = len(ui.lineEditor.input)
 	}
 	ui.Draw()
 }
 
 func (ui *Ui) HandleLineEditorInput(ev termbox.Event) {
 	ui.lineEditor.Handle(ev)
+	if ui.lineEditor.cmd == '/' {
+		ui.searchAsTyped(ui.lineEditor.input)
+	}
 	ui.Draw()
 }
 
@@ -294,6 +468,42 @@ func (ui *Ui) OpenInBrowser() {
 	}
 }
 
+// OpenChart shows the chart of the selected ticker
+func (ui *Ui) OpenChart() {
+	if ui.stockQuotes == nil || len(*ui.stockQuotes) == 0 {
+		return
+	}
+	ui.openChart((*ui.stockQuotes)[ui.selectedQuote].Ticker)
+}
+
+// openChart shows the chart of any ticker, e.g. a market index
+func (ui *Ui) openChart(ticker string) {
+	ui.chart = newChartView(ticker, ui.profile.ChartOverlays)
+	ui.chart.Load(ui.history)
+	*ui.mode = CHART
+	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+	ui.Draw()
+}
+
+// OpenCompare shows the tickers on one chart as percent change
+func (ui *Ui) OpenCompare(tickers []string) {
+	ui.compare = newCompareView(tickers)
+	ui.compare.Load(ui.history)
+	*ui.mode = COMPARE
+	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+	ui.Draw()
+}
+
+// chartWin is the whole screen below the title line, also used by the help
+func (ui *Ui) chartWin() *Win {
+	return &Win{
+		w: ui.titleWin.w,
+		h: ui.commandWin.y - ui.titleWin.h,
+		x: 0,
+		y: ui.titleWin.h,
+	}
+}
+
 func (ui *Ui) HandleSortEvent(key rune) {
 	if key == 'h' || key == 'b' {
 		ui.navigateLabelLeft()
@@ -304,13 +514,22 @@ func (ui *Ui) HandleSortEvent(key rune) {
 	} else if key == '$' {
 		ui.selectedLabel = len(ui.layout.columns) - 1
 	}
+	ui.scrollToColumn(ui.selectedLabel)
 
 	if key == 'j' {
-		ui.sortSymbol = DESCENDING_CHAR
-		ui.sortByLabelDsc()
+		ui.sortByLabel(true, false)
 	} else if key == 'k' {
-		ui.sortSymbol = ASCENDING_CHAR
-		ui.sortByLabelAsc()
+		ui.sortByLabel(false, false)
+	} else if key == 'J' {
+		// J/K add the column as a tie breaker of the current sort
+		ui.sortByLabel(true, true)
+	} else if key == 'K' {
+		ui.sortByLabel(false, true)
+	} else if key == 'x' {
+		ui.setSort(removeSortKey(ui.profile.sort,
+			ui.layout.columns[ui.selectedLabel].name))
+	} else if key == 'm' {
+		ui.setSort(nil)
 	}
 	ui.Draw()
 }
@@ -327,82 +546,229 @@ func (ui *Ui) navigateLabelRight() {
 	}
 }
 
-func (ui *Ui) sortByLabelDsc() {
-	if len(*ui.stockQuotes) == 0 {
+// sortByLabel sorts the quotes by the selected column, or by the current
+// sort then the selected column if then is set
+func (ui *Ui) sortByLabel(descending, then bool) {
+	key := sortKey{Column: ui.layout.columns[ui.selectedLabel].name,
+		Descending: descending}
+	ui.setSort(setSortKey(ui.profile.sort, key, then))
+}
+
+// setSort saves spec with the portfolio and reorders the quotes, keeping
+// the selected ticker selected. An empty spec is the manual order.
+func (ui *Ui) setSort(spec []sortKey) {
+	ui.profile.sort = spec
+	ui.profile.saveSettings()
+	ui.applySort()
+}
+
+func (ui *Ui) applySort() {
+	if ui.stockQuotes == nil || len(*ui.stockQuotes) == 0 {
 		return
 	}
 
 	oldQ := (*ui.stockQuotes)[ui.selectedQuote]
-
-	sort.SliceStable(*ui.stockQuotes, func(i, j int) bool {
-		q := reflect.ValueOf((*ui.stockQuotes)[i]).Field(ui.selectedLabel).Interface()
-		r := reflect.ValueOf((*ui.stockQuotes)[j]).Field(ui.selectedLabel).Interface()
-		f1, isFloat := q.(float64)
-		j1, isJsonNumber := q.(json.Number)
-
-		if isFloat {
-			f2, _ := r.(float64)
-			return f1 > f2
-		} else if isJsonNumber {
-			j2, _ := r.(json.Number)
-			return j1 > j2
-		} else {
-			str, _ := q.(string)
-			str2, _ := r.(string)
-			return str > str2
-		}
-	})
-	ui.profile.Tickers = ui.getSortedTickers(*ui.stockQuotes)
+	sortQuotes(*ui.stockQuotes, ui.profile.sort, ui.layout, ui.profile.Tickers)
+	ui.updateVisibleQuotes()
 	ui.updateSelection(oldQ)
+}
 
+// moveSelected moves the selected ticker delta places in the manual order of
+// the portfolio
+func (ui *Ui) moveSelected(delta int) {
+	if ui.stockQuotes == nil || len(*ui.stockQuotes) == 0 {
+		return
+	}
+	ui.moveTickers([]string{(*ui.stockQuotes)[ui.selectedQuote].Ticker}, delta)
 }
 
-func (ui *Ui) sortByLabelAsc() {
-	if len(*ui.stockQuotes) == 0 {
+// moveTickers moves tickers delta places in the manual order of the
+// portfolio and saves it, keeping the selected ticker selected
+func (ui *Ui) moveTickers(tickers []string, delta int) {
+	if ui.stockQuotes == nil || len(*ui.stockQuotes) == 0 {
+		return
+	}
+	if len(ui.profile.sort) > 0 {
+		ui.lineEditor.PrintErrorf("sorted by %s, :sort manual to reorder",
+			formatSortSpec(ui.profile.sort))
 		return
 	}
 
 	oldQ := (*ui.stockQuotes)[ui.selectedQuote]
-	sort.SliceStable(*ui.stockQuotes, func(i, j int) bool {
-		q := reflect.ValueOf((*ui.stockQuotes)[i]).Field(ui.selectedLabel).Interface()
-		r := reflect.ValueOf((*ui.stockQuotes)[j]).Field(ui.selectedLabel).Interface()
-		f1, isFloat := q.(float64)
-		j1, isJsonNumber := q.(json.Number)
-
-		if isFloat {
-			f2, _ := r.(float64)
-			return f1 < f2
-		} else if isJsonNumber {
-			j2, _ := r.(json.Number)
-			return j1 < j2
-		} else {
-			str, _ := q.(string)
-			str2, _ := r.(string)
-			return str < str2
-		}
-	})
-	ui.profile.Tickers = ui.getSortedTickers(*ui.stockQuotes)
+	selected := map[string]bool{}
+	for _, ticker := range tickers {
+		selected[ticker] = true
+	}
+
+	shown := make([]string, len(*ui.stockQuotes))
+	byTicker := make(map[string]Quote, len(*ui.stockQuotes))
+	for id, q := range *ui.stockQuotes {
+		shown[id] = q.Ticker
+		byTicker[q.Ticker] = q
+	}
+	step := 1
+	if delta < 0 {
+		step, delta = -1, -delta
+	}
+	for i := 0; i < delta; i++ {
+		shown = moveTickers(shown, selected, step)
+	}
+
+	for id, ticker := range shown {
+		(*ui.stockQuotes)[id] = byTicker[ticker]
+	}
+	ui.profile.Tickers = reorderTickers(ui.profile.Tickers, shown)
+	ui.profile.saveOrder()
+
+	ui.updateVisibleQuotes()
 	ui.updateSelection(oldQ)
 }
 
+// sortIndicator is the arrow shown after the name of a sorted column, with
+// the position of the column in the sort when there are several
+func (ui *Ui) sortIndicator(column string) string {
+	id := findSortKey(ui.profile.sort, column)
+	if id < 0 {
+		return ""
+	}
+	arrow := ASCENDING_CHAR
+	if ui.profile.sort[id].Descending {
+		arrow = DESCENDING_CHAR
+	}
+	if len(ui.profile.sort) > 1 {
+		return fmt.Sprintf(" %s%d", arrow, id+1)
+	}
+	return " " + arrow
+}
+
+// tagsOf returns the tags of ticker
+func (ui *Ui) tagsOf(ticker string) []string {
+	return ui.profile.Tags[strings.ToUpper(ticker)]
+}
+
+// noteOf returns the note on ticker
+func (ui *Ui) noteOf(ticker string) string {
+	return ui.profile.Notes[strings.ToUpper(ticker)]
+}
+
+// reloadLayout rebuilds the columns after the custom columns changed
+func (ui *Ui) reloadLayout() {
+	ui.layout = NewLayout(ui.history, ui.tagsOf, ui.noteOf)
+	if err := ui.layout.addCustomColumns(ui.profile.Columns,
+		ui.indicators); err != nil {
+		ui.lineEditor.PrintErrorf("%v", err)
+	}
+	ui.profile.columns = ui.layout.applySettings(ui.profile.columns)
+	if ui.selectedLabel >= len(ui.layout.columns) {
+		ui.selectedLabel = len(ui.layout.columns) - 1
+	}
+	if ui.firstColumn >= len(ui.layout.columns) {
+		ui.firstColumn = len(ui.layout.columns) - 1
+	}
+	if ui.firstColumn < ui.minFirstColumn() {
+		ui.firstColumn = ui.minFirstColumn()
+	}
+}
+
+// frozenColumn returns the index of the Ticker column, which never scrolls,
+// or -1 if it is hidden
+func (ui *Ui) frozenColumn() int {
+	for id, col := range ui.layout.columns {
+		if col.name == "Ticker" {
+			return id
+		}
+	}
+	return -1
+}
+
+// minFirstColumn is the first column that scrolls
+func (ui *Ui) minFirstColumn() int {
+	if ui.frozenColumn() == 0 {
+		return 1
+	}
+	return 0
+}
+
+// shownColumns returns the indices of the columns that fit in the stock
+// window: the Ticker column, which never scrolls, then the others from
+// firstColumn on. more is set when columns are cut off on the right.
+func (ui *Ui) shownColumns() (shown []int, more bool) {
+	columns := ui.layout.columns
+	if len(columns) == 0 {
+		return nil, false
+	}
+
+	shown = []int{}
+	x := 0
+	frozen := ui.frozenColumn()
+	if frozen >= 0 {
+		shown = append(shown, frozen)
+		x = columns[frozen].width
+	}
+	for i := ui.firstColumn; i < len(columns); i++ {
+		if i == frozen {
+			continue
+		}
+		if x >= ui.stockWin.w {
+			return shown, true
+		}
+		shown = append(shown, i)
+		x += columns[i].width
+	}
+	return shown, x > ui.stockWin.w
+}
+
+func (ui *Ui) scrollColumnsRight() {
+	if _, more := ui.shownColumns(); more {
+		ui.firstColumn += 1
+		if ui.firstColumn == ui.frozenColumn() {
+			ui.firstColumn += 1
+		}
+	}
+}
+
+func (ui *Ui) scrollColumnsLeft() {
+	if ui.firstColumn > ui.minFirstColumn() {
+		ui.firstColumn -= 1
+		if ui.firstColumn == ui.frozenColumn() && ui.firstColumn > 0 {
+			ui.firstColumn -= 1
+		}
+	}
+}
+
+func (ui *Ui) scrollColumnsStart() {
+	ui.firstColumn = ui.minFirstColumn()
+}
+
+func (ui *Ui) scrollColumnsEnd() {
+	for _, more := ui.shownColumns(); more; _, more = ui.shownColumns() {
+		ui.scrollColumnsRight()
+	}
+}
+
+// scrollToColumn scrolls horizontally until column i is fully visible
+func (ui *Ui) scrollToColumn(i int) {
+	if i == ui.frozenColumn() {
+		return
+	}
+	if i < ui.firstColumn {
+		ui.firstColumn = i
+		return
+	}
+	for ui.firstColumn < i {
+		shown, more := ui.shownColumns()
+		if last := shown[len(shown)-1]; last > i || (last == i && !more) {
+			return
+		}
+		ui.scrollColumnsRight()
+	}
+}
+
+// updateSelection selects newQ if it is in the list
 func (ui *Ui) updateSelection(newQ Quote) {
 	for id := range *ui.stockQuotes {
 		if (*ui.stockQuotes)[id] == newQ {
-			if id < ui.zerothQuote {
-				// case if selected quote above current window
-				for id < ui.zerothQuote {
-					ui.navigateStockUp()
-				}
-			} else if id >= ui.zerothQuote+ui.stockWin.h {
-				// case if selected quote is below current window
-				for id >= ui.zerothQuote+ui.stockWin.h {
-					ui.navigateStockDown()
-				}
-			} else {
-				// case if selected quote is exists in current window
-				ui.selectedQuote = id
-				ui.selectedVisibleQuote = ui.selectedQuote - ui.zerothQuote
-			}
+			ui.selectQuote(id)
 			break
 		}
 	}
@@ -410,7 +776,7 @@ func (ui *Ui) updateSelection(newQ Quote) {
 
 func (ui *Ui) resetSelection() {
 	// must be called in conjunction with GetQuotes()
-	if len(*ui.stockQuotes) == 0 {
+	if ui.stockQuotes == nil || len(*ui.stockQuotes) == 0 {
 		return
 	}
 	ui.zerothQuote = 0
@@ -418,14 +784,6 @@ func (ui *Ui) resetSelection() {
 	ui.selectedQuote = 0
 }
 
-func (ui *Ui) getSortedTickers(quotes []Quote) []string {
-	tickers := make([]string, len(quotes))
-	for id, q := range quotes {
-		tickers[id] = q.Ticker
-	}
-	return tickers
-}
-
 // Temp for playing around with termbox
 func (ui *Ui) drawTitleLine() {
 	fg, bg := termbox.ColorDefault|termbox.AttrBold, termbox.ColorDefault
@@ -444,23 +802,34 @@ func (ui *Ui) drawTitleLine() {
 func (ui *Ui) drawLabelWin() {
 	fg, bg := termbox.ColorDefault|termbox.AttrUnderline, termbox.ColorDefault
 
-	x := 0
-	var label string
+	ui.labelWin.Clear()
+	shown, more := ui.shownColumns()
 
-	for id, col := range ui.layout.columns {
+	var label string
+	x := 0
+	for _, id := range shown {
+		col := ui.layout.columns[id]
+		label = fmt.Sprintf("%-*v", col.width, col.name+ui.sortIndicator(col.name))
 		if id == ui.selectedLabel && *ui.mode == SORT {
-			label = fmt.Sprintf("%-*v", col.width, col.name+" "+ui.sortSymbol)
-			ui.labelWin.print(x, 0, termbox.ColorBlack, termbox.ColorWhite, label)
-		} else if id == ui.selectedLabel && *ui.mode != SORT {
-			label = fmt.Sprintf("%-*v", col.width, col.name+" "+ui.sortSymbol)
-			ui.labelWin.print(x, 0, fg, bg, label)
+			ui.labelWin.print(x, 0, colors.selectedFg, colors.selectedBg, label)
 		} else {
-			label = fmt.Sprintf("%-*v", col.width, col.name)
 			ui.labelWin.print(x, 0, fg, bg, label)
 		}
-		x += utf8.RuneCountInString(label)
+		x += col.width
 	}
 
+	// show that columns are scrolled off to the left or right
+	if ui.firstColumn > ui.minFirstColumn() && len(shown) > 0 {
+		x := 0
+		if frozen := ui.frozenColumn(); frozen >= 0 {
+			x = ui.layout.columns[frozen].width - 1
+		}
+		ui.labelWin.print(x, 0, termbox.ColorYellow, bg, MORE_LEFT_CHAR)
+	}
+	if more {
+		ui.labelWin.print(ui.labelWin.w-1, 0, termbox.ColorYellow, bg,
+			MORE_RIGHT_CHAR)
+	}
 }
 
 func (ui *Ui) drawMarketWin() {
@@ -473,9 +842,10 @@ func (ui *Ui) drawMarketWin() {
 
 	x := 0
 	y := 0
+	ui.marketHits = ui.marketHits[:0]
 	for _, q := range *ui.marketQuotes {
 		humanFormatted := float2Str(q.LastTrade, 2)
-		tickerLine := fmt.Sprintf("%s %s %.2f", marketNames[q.Ticker],
+		tickerLine := fmt.Sprintf("%s %s %.2f", marketName(q.Ticker),
 			humanFormatted, q.ChangePct)
 		if x+len(tickerLine) > ui.marketWin.w {
 			y++
@@ -484,12 +854,15 @@ func (ui *Ui) drawMarketWin() {
 		if y >= ui.marketWin.h-1 {
 			break
 		}
-		indexLabel := fmt.Sprintf("%s ", marketNames[q.Ticker])
-		ui.marketWin.print(x, y, termbox.ColorYellow, bg, indexLabel)
+		start := x
+		indexLabel := fmt.Sprintf("%s ", marketName(q.Ticker))
+		ui.marketWin.print(x, y, colors.label, bg, indexLabel)
 		x += len(indexLabel)
 		changeLabel := fmt.Sprintf("%s (%.2f%%)  ", humanFormatted, q.ChangePct)
 		ui.marketWin.print(x, y, fg, bg, changeLabel)
 		x += len(changeLabel)
+		ui.marketHits = append(ui.marketHits, marketHit{x: start, y: y,
+			w: x - start, ticker: q.Ticker})
 
 	}
 }
@@ -501,8 +874,10 @@ func (ui *Ui) drawStockWin() {
 
 	_, bg := termbox.ColorDefault, termbox.ColorDefault
 
+	ui.stockWin.Clear()
+	shown, _ := ui.shownColumns()
+
 	for id, q := range ui.visibleQuotes {
-		tickerLine := ""
 		highlightColor := bg
 		if q.Ticker == "" {
 			// TODO BAD antipattern, should fix this
@@ -513,63 +888,30 @@ func (ui *Ui) drawStockWin() {
 			continue
 		}
 
-		var lineColor termbox.Attribute
-		if q.Change > 0 {
-			lineColor = termbox.ColorGreen
-		} else if q.Change == 0 {
-			lineColor = termbox.ColorBlue
+		highlighted := true
+		lineColor := colors.selectedFg
+		if ui.selectedVisibleQuote == id && *ui.mode != SORT {
+			highlightColor = colors.selectedBg
+		} else if ui.inVisual(ui.zerothQuote + id) {
+			highlightColor = colors.visualBg
+		} else if hasActiveAlert(ui.profile.Alerts, q.Ticker) {
+			highlightColor = colors.alertBg
 		} else {
-			lineColor = termbox.ColorRed
+			highlighted = false
 		}
 
-		if ui.selectedVisibleQuote == id && *ui.mode != SORT {
-			highlightColor = termbox.ColorWhite
-			lineColor = termbox.ColorBlack
-		}
-
-		v := reflect.ValueOf(q)
-
-		for i := 0; i < v.NumField(); i++ {
-			fieldVal := v.Field(i).Interface()
-			val, ok := fieldVal.(float64)
-			if ok {
-				if strings.Contains(ui.layout.columns[i].name, "Div") {
-					// get dividend yield %
-					val = val * 100
-				}
-				humanFormatted := float2Str(val, ui.layout.columns[i].precision)
-				if (strings.Contains(ui.layout.columns[i].name, "Change") ||
-					strings.Contains(ui.layout.columns[i].name, "After") ||
-					strings.Contains(ui.layout.columns[i].name, "Pre")) &&
-					val >= 0 {
-					// TODO: just add an "advancing" field in Quote
-					humanFormatted = "+" + humanFormatted
-					tickerLine = tickerLine + fmt.Sprintf("%-*v",
-						ui.layout.columns[i].width, humanFormatted)
-				} else {
-					tickerLine = tickerLine + fmt.Sprintf("%-*v",
-						ui.layout.columns[i].width, humanFormatted)
-				}
-			} else if strings.Contains(ui.layout.columns[i].name, "Earnings") {
-				earningsTs := string(fieldVal.(json.Number))
-				earningsTsInt, err := strconv.ParseInt(earningsTs, 10, 64)
-				earningsStr := "-"
-
-				if err == nil {
-					tm := time.Unix(earningsTsInt, 0)
-					earningsStr = tm.Format(layoutUS)
-				}
-
-				tickerLine = tickerLine + fmt.Sprintf("%-*v",
-					ui.layout.columns[i].width, earningsStr)
-
-			} else {
-				tickerLine = tickerLine + fmt.Sprintf("%-*v",
-					ui.layout.columns[i].width, fieldVal)
+		x := 0
+		for _, i := range shown {
+			col := &ui.layout.columns[i]
+			v := col.value(q)
+			if !highlighted {
+				lineColor = col.color(q, v)
 			}
+			cell := fmt.Sprintf("%-*v", col.width, col.format(col, v))
+			ui.stockWin.print(x, id, lineColor, highlightColor, cell)
+			ui.drawMatches(x, id, col, q, lineColor, highlightColor)
+			x += col.width
 		}
-
-		ui.stockWin.print(0, id, lineColor, highlightColor, tickerLine)
 	}
 }
 
@@ -579,13 +921,26 @@ func (ui *Ui) drawCommandWin() {
 
 func (ui *Ui) GetQuotes() {
 	var err error
-	ui.stockQuotes, err = FetchQuotes(ui.profile.Tickers)
+	ui.stockQuotes, err = fetchQuotes(ui.profile.Tickers)
 	if err != nil {
 		ui.lineEditor.PrintErrorf("couldn't fetch quotes:  %v", err)
 		return
 	}
 
-	ui.marketQuotes, err = FetchMarket()
+	ui.refreshHistory(false)
+	ui.indicators.Reset()
+
+	if fired := evaluateAlerts(ui.profile.Alerts, *ui.stockQuotes,
+		ui.indicators); len(fired) > 0 {
+		ui.reportAlerts(fired)
+	}
+	ui.applyFilter()
+	sortQuotes(*ui.stockQuotes, ui.profile.sort, ui.layout, ui.profile.Tickers)
+
+	ui.marketQuotes = nil
+	if ui.profile.boolOption("market") {
+		ui.marketQuotes, err = fetchQuotes(ui.profile.listOption("markets"))
+	}
 
 	if err != nil {
 		ui.lineEditor.PrintErrorf("couldn't fetch quotes:  %v", err)
@@ -598,14 +953,62 @@ func (ui *Ui) GetQuotes() {
 		ui.stockWin.h = len(*ui.stockQuotes)
 	}
 
-	ui.visibleQuotes = (*ui.stockQuotes)[ui.zerothQuote : ui.zerothQuote+
-		ui.stockWin.h]
+	// the list may have shrunk, e.g. under a filter
+	ui.selectQuote(ui.selectedQuote)
 	ui.lineEditor.quotes = ui.stockQuotes
+}
+
+// applyFilter drops the quotes for which the list filter doesn't hold
+func (ui *Ui) applyFilter() {
+	if ui.profile.filter == "" {
+		return
+	}
+	expr, err := parseExpr(ui.profile.filter)
+	if err != nil {
+		return
+	}
+	filtered := []Quote{}
+	for _, q := range *ui.stockQuotes {
+		if truthy(expr.eval(exprEnv{quote: q, indicators: ui.indicators,
+			tags: ui.tagsOf})) {
+			filtered = append(filtered, q)
+		}
+	}
+	ui.stockQuotes = &filtered
+}
+
+// historyRanges returns the ranges of price history needed by the visible
+// columns, the alerts and the list filter
+func (ui *Ui) historyRanges() []string {
+	needed := ui.layout.historyRanges()
+	if alertsUseIndicators(ui.profile.Alerts) {
+		needed = append(needed, indicatorRange)
+	}
+	if expr, err := parseExpr(ui.profile.filter); err == nil && usesIndicators(expr) {
+		needed = append(needed, indicatorRange)
+	}
+
+	ranges := []string{}
+	seen := map[string]bool{}
+	for _, rng := range needed {
+		if !seen[rng] {
+			seen[rng] = true
+			ranges = append(ranges, rng)
+		}
+	}
+	return ranges
+}
 
-	if ui.sortSymbol == DESCENDING_CHAR {
-		ui.HandleSortEvent('j')
-	} else if ui.sortSymbol == ASCENDING_CHAR {
-		ui.HandleSortEvent('k')
+// refreshHistory fetches the price history needed by the visible columns,
+// or only the ranges that were never fetched if onlyMissing is set
+func (ui *Ui) refreshHistory(onlyMissing bool) {
+	for _, rng := range ui.historyRanges() {
+		if onlyMissing && ui.history.Has(rng) {
+			continue
+		}
+		if err := ui.history.Refresh(ui.profile.Tickers, rng); err != nil {
+			ui.lineEditor.PrintErrorf("couldn't fetch price history:  %v", err)
+		}
 	}
 }
 
@@ -622,46 +1025,127 @@ func (ui *Ui) updateVisibleQuotes() {
 }
 
 func (ui *Ui) navigateStockBeginning() {
-	for ui.selectedQuote > 0 {
-		ui.navigateStockUp()
-	}
+	ui.selectQuote(0)
 }
 
 func (ui *Ui) navigateStockEnd() {
-	for ui.selectedQuote < len(*ui.stockQuotes)-1 {
-		ui.navigateStockDown()
+	if ui.stockQuotes != nil {
+		ui.selectQuote(len(*ui.stockQuotes) - 1)
 	}
 }
 
 func (ui *Ui) navigateStockDown() {
-	updatedPos := ui.selectedQuote + 1
-	if updatedPos >= len(*ui.stockQuotes) || len(*ui.stockQuotes) == 0 {
+	ui.navigateStockBy(1)
+}
+
+func (ui *Ui) navigateStockUp() {
+	ui.navigateStockBy(-1)
+}
+
+// navigateStockBy moves the selection delta rows down, or up if negative
+func (ui *Ui) navigateStockBy(delta int) {
+	ui.selectQuote(ui.selectedQuote + delta)
+}
+
+// selectQuote selects row i of the list, clamped to the list, scrolling as
+// little as needed to show it
+func (ui *Ui) selectQuote(i int) {
+	if ui.stockQuotes == nil {
 		return
 	}
+	if i >= len(*ui.stockQuotes) {
+		i = len(*ui.stockQuotes) - 1
+	}
+	if i < 0 {
+		i = 0
+	}
+	ui.selectedQuote = i
 
-	if ui.selectedVisibleQuote+1 < ui.stockWin.h {
-		ui.selectedQuote = updatedPos
-		ui.selectedVisibleQuote += 1
-	} else if ui.selectedVisibleQuote+1 >= ui.stockWin.h {
-		ui.zerothQuote += 1
-		ui.selectedQuote = updatedPos
-		ui.updateVisibleQuotes() // Update the visibleQuotes slice.
+	zeroth := ui.zerothQuote
+	if i < zeroth {
+		zeroth = i
+	} else if i >= zeroth+ui.stockWin.h {
+		zeroth = i - ui.stockWin.h + 1
 	}
+	ui.scrollList(zeroth)
 }
 
-func (ui *Ui) navigateStockUp() {
-	updatedPos := ui.selectedQuote - 1
-	if updatedPos < 0 || len(*ui.stockQuotes) == 0 {
+// scrollList shows the list from row zeroth on, clamped so that the window
+// stays full, and moves the selection onto the screen if it scrolled off
+func (ui *Ui) scrollList(zeroth int) {
+	if ui.stockQuotes == nil {
+		return
+	}
+	n, h := len(*ui.stockQuotes), ui.stockWin.h
+	if zeroth > n-h {
+		zeroth = n - h
+	}
+	if zeroth < 0 {
+		zeroth = 0
+	}
+	ui.zerothQuote = zeroth
+
+	if ui.selectedQuote < zeroth {
+		ui.selectedQuote = zeroth
+	} else if h > 0 && ui.selectedQuote >= zeroth+h {
+		ui.selectedQuote = zeroth + h - 1
+	}
+	if ui.selectedQuote >= n {
+		ui.selectedQuote = n - 1
+	}
+	if ui.selectedQuote < 0 {
+		ui.selectedQuote = 0
+	}
+	ui.selectedVisibleQuote = ui.selectedQuote - ui.zerothQuote
+	ui.updateVisibleQuotes()
+}
+
+// shownRows is the number of rows of the list on screen
+func (ui *Ui) shownRows() int {
+	if rows := len(*ui.stockQuotes) - ui.zerothQuote; rows < ui.stockWin.h {
+		return rows
+	}
+	return ui.stockWin.h
+}
+
+// pageStocks scrolls the list and the selection by delta rows, as with
+// Ctrl-D and Ctrl-F
+func (ui *Ui) pageStocks(delta int) {
+	if ui.stockQuotes == nil {
+		return
+	}
+	selected := ui.selectedQuote + delta
+	ui.scrollList(ui.zerothQuote + delta)
+	ui.selectQuote(selected)
+}
+
+// selectScreenRow selects a row relative to the screen: the count-th row
+// from the top (H), the middle row (M) or the count-th row from the bottom
+// (L)
+func (ui *Ui) selectScreenRow(where rune, count int) {
+	if ui.stockQuotes == nil {
 		return
 	}
+	switch where {
+	case 'H':
+		ui.selectQuote(ui.zerothQuote + count - 1)
+	case 'M':
+		ui.selectQuote(ui.zerothQuote + (ui.shownRows()-1)/2)
+	case 'L':
+		ui.selectQuote(ui.zerothQuote + ui.shownRows() - count)
+	}
+}
 
-	if ui.selectedVisibleQuote-1 >= 0 {
-		ui.selectedQuote = updatedPos
-		ui.selectedVisibleQuote -= 1
-	} else if updatedPos < ui.zerothQuote && ui.zerothQuote > 0 {
-		ui.zerothQuote -= 1
-		ui.selectedQuote = updatedPos
-		ui.updateVisibleQuotes() // Update the visibleQuotes slice.
+// scrollSelectionTo scrolls the list so that the selected row is at the
+// top (zt), in the middle (zz) or at the bottom (zb) of the screen
+func (ui *Ui) scrollSelectionTo(where rune) {
+	switch where {
+	case 't':
+		ui.scrollList(ui.selectedQuote)
+	case 'z':
+		ui.scrollList(ui.selectedQuote - ui.stockWin.h/2)
+	case 'b':
+		ui.scrollList(ui.selectedQuote - ui.stockWin.h + 1)
 	}
 }
 
@@ -677,3 +1161,219 @@ func (ui *Ui) getQuoteByTicker(ticker string) *Quote {
 	}
 	return nil
 }
+
+func (ui *Ui) reportAlerts(fired []firedAlert) {
+	ringBell()
+	for _, alert := range fired {
+		ui.notifier.Deliver(alert)
+	}
+	if *ui.mode == COMMAND {
+		// don't clobber what the user is typing, the row is still highlighted
+		return
+	}
+	rules := make([]string, len(fired))
+	for id, alert := range fired {
+		rules[id] = alert.rule.String()
+	}
+	ui.lineEditor.message = "alert: " + strings.Join(rules, ", ")
+}
+
+func (ui *Ui) drawAlertsWin() {
+	fg, bg := termbox.ColorDefault|termbox.AttrUnderline, termbox.ColorDefault
+
+	ui.labelWin.Clear()
+	header := fmt.Sprintf("%-*v%-*v%-*v%v", 24, "Alert", 12, "State", 20,
+		"Last Fired", "(a)ck (e)dit (n)ew (d)elete")
+	ui.labelWin.print(0, 0, fg, bg, header)
+
+	win := ui.overlayWin()
+	win.Clear()
+
+	if len(ui.profile.Alerts) == 0 {
+		win.print(0, 0, termbox.ColorDefault, bg,
+			"no alerts, press n to add one")
+		return
+	}
+
+	first := 0
+	if ui.selectedAlert >= win.h {
+		first = ui.selectedAlert - win.h + 1
+	}
+
+	for id := first; id < len(ui.profile.Alerts) && id-first < win.h; id++ {
+		rule := ui.profile.Alerts[id]
+		lineColor, highlightColor := termbox.ColorDefault, bg
+
+		state := "armed"
+		if rule.Triggered && rule.Acked {
+			state = "acked"
+		} else if rule.Triggered {
+			state = "TRIGGERED"
+			lineColor = termbox.ColorYellow
+		}
+
+		lastFired := "-"
+		if !rule.LastFired.IsZero() {
+			lastFired = rule.LastFired.Format("01/02 15:04:05")
+		}
+
+		if id == ui.selectedAlert && *ui.mode == ALERTS {
+			lineColor, highlightColor = colors.selectedFg, colors.selectedBg
+		}
+
+		line := fmt.Sprintf("%-*v%-*v%-*v", 24, rule.String(), 12, state, 20,
+			lastFired)
+		win.print(0, id-first, lineColor, highlightColor, line)
+	}
+}
+
+func (ui *Ui) navigateAlertDown() {
+	if ui.selectedAlert < len(ui.profile.Alerts)-1 {
+		ui.selectedAlert += 1
+	}
+}
+
+func (ui *Ui) navigateAlertUp() {
+	if ui.selectedAlert > 0 {
+		ui.selectedAlert -= 1
+	}
+}
+
+func (ui *Ui) acknowledgeAlert() {
+	if ui.selectedAlert < len(ui.profile.Alerts) {
+		ui.profile.Alerts[ui.selectedAlert].Acked = true
+	}
+}
+
+func (ui *Ui) deleteAlert() {
+	if ui.selectedAlert >= len(ui.profile.Alerts) {
+		return
+	}
+	ui.profile.Alerts = append(ui.profile.Alerts[:ui.selectedAlert],
+		ui.profile.Alerts[ui.selectedAlert+1:]...)
+	if ui.selectedAlert > 0 && ui.selectedAlert >= len(ui.profile.Alerts) {
+		ui.selectedAlert -= 1
+	}
+}
+
+// overlayWin is the area between the labels and the command window used by
+// the alerts and columns views. The stock window shrinks to the number of
+// quotes, so it can't be used for these.
+func (ui *Ui) overlayWin() *Win {
+	return &Win{
+		w: ui.stockWin.w,
+		h: ui.commandWin.y - ui.stockWin.y,
+		x: ui.stockWin.x,
+		y: ui.stockWin.y,
+	}
+}
+
+func (ui *Ui) drawColumnsWin() {
+	fg, bg := termbox.ColorDefault|termbox.AttrUnderline, termbox.ColorDefault
+
+	ui.labelWin.Clear()
+	header := fmt.Sprintf("%-*v%-*v%v", 20, "Column", 8, "Width",
+		"(space) show/hide  J/K move  </> width")
+	ui.labelWin.print(0, 0, fg, bg, header)
+
+	win := ui.overlayWin()
+	win.Clear()
+
+	widths := map[string]int{}
+	for _, col := range ui.layout.all {
+		widths[col.name] = col.width
+	}
+
+	settings := ui.profile.columns
+	first := 0
+	if ui.selectedColumn >= win.h {
+		first = ui.selectedColumn - win.h + 1
+	}
+
+	for id := first; id < len(settings) && id-first < win.h; id++ {
+		setting := settings[id]
+		lineColor, highlightColor := termbox.ColorDefault, bg
+
+		shown := "[x]"
+		if setting.Hidden {
+			shown = "[ ]"
+			lineColor = termbox.ColorBlue
+		}
+		width := widths[setting.Name]
+		if setting.Width > 0 {
+			width = setting.Width
+		}
+
+		if id == ui.selectedColumn {
+			lineColor, highlightColor = colors.selectedFg, colors.selectedBg
+		}
+
+		line := fmt.Sprintf("%s %-*v%-*v", shown, 16, setting.Name, 8, width)
+		win.print(0, id-first, lineColor, highlightColor, line)
+	}
+}
+
+func (ui *Ui) navigateColumnDown() {
+	if ui.selectedColumn < len(ui.profile.columns)-1 {
+		ui.selectedColumn += 1
+	}
+}
+
+func (ui *Ui) navigateColumnUp() {
+	if ui.selectedColumn > 0 {
+		ui.selectedColumn -= 1
+	}
+}
+
+func (ui *Ui) toggleColumn() {
+	settings := ui.profile.columns
+	if ui.selectedColumn >= len(settings) {
+		return
+	}
+	setting := &settings[ui.selectedColumn]
+	if !setting.Hidden && countVisible(settings) == 1 {
+		ui.lineEditor.PrintErrorf("can't hide the last column")
+		return
+	}
+	setting.Hidden = !setting.Hidden
+	ui.columnsChanged()
+}
+
+// moveColumn moves the selected column by delta places in the display order
+func (ui *Ui) moveColumn(delta int) {
+	to := ui.selectedColumn + delta
+	if to < 0 || to >= len(ui.profile.columns) {
+		return
+	}
+	moveColumnSetting(ui.profile.columns, ui.selectedColumn, to)
+	ui.selectedColumn = to
+	ui.columnsChanged()
+}
+
+// resizeColumn changes the width of the selected column by delta
+func (ui *Ui) resizeColumn(delta int) {
+	if ui.selectedColumn >= len(ui.profile.columns) {
+		return
+	}
+	setting := &ui.profile.columns[ui.selectedColumn]
+	width := setting.Width
+	if width == 0 {
+		for _, col := range ui.layout.all {
+			if col.name == setting.Name {
+				width = col.width
+			}
+		}
+	}
+	width += delta
+	if width < 1 || width > maxColumnWidth {
+		return
+	}
+	setting.Width = width
+	ui.columnsChanged()
+}
+
+func (ui *Ui) columnsChanged() {
+	ui.profile.saveSettings()
+	ui.reloadLayout()
+	ui.refreshHistory(true)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testUi is a Ui with the default columns and a stock window w wide
+func testUi(w int, settings []columnSetting) *Ui {
+	ui := &Ui{
+		stockWin: &Win{w: w},
+		profile:  &profile{columns: settings},
+	}
+	ui.layout = NewLayout(nil, ui.tagsOf, ui.noteOf)
+	ui.profile.columns = ui.layout.applySettings(settings)
+	ui.firstColumn = ui.minFirstColumn()
+	return ui
+}
+
+func shownNames(ui *Ui) []string {
+	shown, _ := ui.shownColumns()
+	names := []string{}
+	for _, id := range shown {
+		names = append(names, ui.layout.columns[id].name)
+	}
+	return names
+}
+
+func TestShownColumnsFreezeTicker(t *testing.T) {
+	ui := testUi(39, nil)
+	assert.Equal(t, []string{"Ticker", "Last", "Change", "Change %"}, shownNames(ui))
+
+	ui.scrollColumnsRight()
+	assert.Equal(t, []string{"Ticker", "Change", "Change %", "Open"}, shownNames(ui))
+
+	ui.scrollColumnsStart()
+	assert.Equal(t, 1, ui.firstColumn)
+	ui.scrollColumnsLeft()
+	assert.Equal(t, 1, ui.firstColumn)
+}
+
+func TestShownColumnsFreezeMovedTicker(t *testing.T) {
+	// as after :column move Ticker 3
+	ui := testUi(39, []columnSetting{{Name: "Last"}, {Name: "Change"},
+		{Name: "Ticker"}})
+	assert.Equal(t, 0, ui.firstColumn)
+	assert.Equal(t, []string{"Ticker", "Last", "Change", "Change %"}, shownNames(ui))
+
+	for i := 0; i < 4; i++ {
+		ui.scrollColumnsRight()
+		assert.Equal(t, "Ticker", shownNames(ui)[0])
+		assert.Len(t, shownNames(ui), 4)
+	}
+	assert.Equal(t, []string{"Ticker", "Low", "High", "Volume"}, shownNames(ui))
+
+	for i := 0; i < 10; i++ {
+		ui.scrollColumnsLeft()
+	}
+	assert.Equal(t, 0, ui.firstColumn)
+	assert.Equal(t, []string{"Ticker", "Last", "Change", "Change %"}, shownNames(ui))
+}
+
+func TestShownColumnsWithoutTicker(t *testing.T) {
+	// as after :column hide Ticker
+	ui := testUi(30, []columnSetting{{Name: "Ticker", Hidden: true}})
+	assert.Equal(t, []string{"Last", "Change", "Change %"}, shownNames(ui))
+
+	ui.scrollColumnsRight()
+	assert.Equal(t, []string{"Change", "Change %", "Open"}, shownNames(ui))
+}
+
+func TestScrollToColumnSkipsTicker(t *testing.T) {
+	ui := testUi(39, []columnSetting{{Name: "Last"}, {Name: "Ticker"}})
+	ui.scrollToColumn(1)
+	assert.Equal(t, 0, ui.firstColumn)
+
+	ui.scrollToColumn(len(ui.layout.columns) - 1)
+	shown, more := ui.shownColumns()
+	assert.False(t, more)
+	assert.Equal(t, len(ui.layout.columns)-1, shown[len(shown)-1])
+	assert.Equal(t, "Ticker", shownNames(ui)[0])
+}
+
+func TestSourceStartupOnAFreshUi(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monmop")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	mode := NORMAL
+	ui := newUI(&profile{filepath: filepath.Join(dir, "monmoprc")}, &mode)
+	require.Nil(t, ui.stockQuotes)
+
+	// no tickers and no market indices, nothing to fetch
+	path := filepath.Join(dir, "monmoprc.cmds")
+	require.NoError(t, ioutil.WriteFile(path,
+		[]byte("set nomarket\ncolumn hide Volume\n"), 0644))
+	assert.True(t, ui.SourceStartup(path))
+	assert.Equal(t, "", ui.lineEditor.promptError)
+	assert.False(t, ui.profile.boolOption("market"))
+	assert.NotContains(t, shownNames(ui), "Volume")
+
+	assert.False(t, ui.SourceStartup(filepath.Join(dir, "missing.cmds")))
+}
+
+func TestSourceStartupFilterByTag(t *testing.T) {
+	stubQuotes(t, "AAPL", "MSFT", "IBM")
+	dir, err := ioutil.TempDir("", "monmop")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	mode := NORMAL
+	ui := newUI(&profile{
+		filepath: filepath.Join(dir, "monmoprc"),
+		Tickers:  []string{"AAPL", "MSFT", "IBM"},
+		Tags:     map[string][]string{"AAPL": {"core"}, "IBM": {"core", "old"}},
+	}, &mode)
+
+	path := filepath.Join(dir, "monmoprc.cmds")
+	require.NoError(t, ioutil.WriteFile(path,
+		[]byte("\" only the core holdings\n:set nomarket\n:filter #core\n"), 0644))
+	assert.True(t, ui.SourceStartup(path))
+	assert.Equal(t, "", ui.lineEditor.promptError)
+
+	tickers := []string{}
+	for _, q := range *ui.stockQuotes {
+		tickers = append(tickers, q.Ticker)
+	}
+	assert.Equal(t, []string{"AAPL", "IBM"}, tickers)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// startVisual selects rows from the selected one on, the selection follows
+// the cursor until VISUAL mode is left
+func (ui *Ui) startVisual() {
+	if ui.stockQuotes == nil || len(*ui.stockQuotes) == 0 {
+		return
+	}
+	ui.visualAnchor = ui.selectedQuote
+	*ui.mode = VISUAL
+}
+
+func (ui *Ui) stopVisual() {
+	ui.visualAnchor = -1
+	if *ui.mode == VISUAL {
+		*ui.mode = NORMAL
+	}
+}
+
+// visualRange returns the first and last row of the selection, which is
+// the selected row alone outside of VISUAL mode
+func (ui *Ui) visualRange() (int, int) {
+	if ui.visualAnchor < 0 || ui.visualAnchor >= len(*ui.stockQuotes) {
+		return ui.selectedQuote, ui.selectedQuote
+	}
+	if ui.visualAnchor < ui.selectedQuote {
+		return ui.visualAnchor, ui.selectedQuote
+	}
+	return ui.selectedQuote, ui.visualAnchor
+}
+
+// inVisual reports whether row is highlighted as part of the selection,
+// also while a prompt for the selection is open
+func (ui *Ui) inVisual(row int) bool {
+	if ui.visualAnchor < 0 || (*ui.mode != VISUAL && *ui.mode != COMMAND) {
+		return false
+	}
+	first, last := ui.visualRange()
+	return row >= first && row <= last
+}
+
+// selectionTickers returns the tickers of the selected rows in list order
+func (ui *Ui) selectionTickers() []string {
+	if ui.stockQuotes == nil || len(*ui.stockQuotes) == 0 {
+		return nil
+	}
+	first, last := ui.visualRange()
+	tickers := []string{}
+	for _, q := range (*ui.stockQuotes)[first : last+1] {
+		tickers = append(tickers, q.Ticker)
+	}
+	return tickers
+}
+
+// moveSelection moves the selected rows delta places in the manual order,
+// the selection moves along with them
+func (ui *Ui) moveSelection(delta int) {
+	if ui.visualAnchor < 0 || ui.visualAnchor >= len(*ui.stockQuotes) {
+		return
+	}
+	anchor := (*ui.stockQuotes)[ui.visualAnchor].Ticker
+	ui.moveTickers(ui.selectionTickers(), delta)
+	ui.visualAnchor = getQuoteId(*ui.stockQuotes, anchor)
+}
+
+// PromptSelection prompts for a command acting on the selected rows
+func (ui *Ui) PromptSelection(cmd rune) {
+	ui.prompt(cmd, ui.selectionTickers())
+}
+
+// exportSelection writes the visible columns of the selected rows to path
+// as CSV
+func (ui *Ui) exportSelection(path string, tickers []string) error {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return fmt.Errorf("usage: export to <file>")
+	}
+	path = expandHome(path)
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	header := make([]string, len(ui.layout.columns))
+	for id, col := range ui.layout.columns {
+		header[id] = col.name
+	}
+	w.Write(header)
+	for _, ticker := range tickers {
+		q := ui.getQuoteByTicker(ticker)
+		if q == nil {
+			continue
+		}
+		record := make([]string, len(ui.layout.columns))
+		for id := range ui.layout.columns {
+			col := &ui.layout.columns[id]
+			record[id] = strings.TrimSpace(col.format(col, col.value(*q)))
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return file.Close()
+}
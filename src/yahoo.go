@@ -5,14 +5,41 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	neturl "net/url"
 	"strings"
+	"sync"
+	"time"
 )
 
 const apiURLv7 = `https://query1.finance.yahoo.com/v7/finance/quote?symbols=%s`
 const apiURLv7ExtraParams = `&range=1d&interval=5m&indicators=close&includeTimestamps=false&includePrePost=false&corsDomain=finance.yahoo.com&.tsrc=finance`
 
+const apiURLChart = `https://query1.finance.yahoo.com/v8/finance/chart/%s?range=%s&interval=%s&includePrePost=false`
+
+const apiURLSearch = `https://query1.finance.yahoo.com/v1/finance/search?q=%s&quotesCount=5&newsCount=0`
+
 const noDataIndicator = `N/A`
 
+// the symbol search only gives suggestions, which aren't worth a long wait
+const searchTimeout = 3 * time.Second
+
+var searchClient = &http.Client{Timeout: searchTimeout}
+
+// bar size used for each history range
+var historyIntervals = map[string]string{
+	"1d":  "5m",
+	"5d":  "30m",
+	"1mo": "1d",
+	"3mo": "1d",
+	"6mo": "1d",
+	"1y":  "1d",
+	"5y":  "1wk",
+}
+
+// max number of history requests in flight at once
+const maxHistoryFetches = 8
+
+// market indices shown by default
 var marketTickers = []string{
 	"^DJI",     // Dow Jones
 	"^GSPC",    // S&P 500
@@ -34,17 +61,16 @@ var marketTickers = []string{
 // for all the fields except 'Advancing' is fetched using Yahoo market API.
 type Quote struct {
 	Ticker    string  `json:"symbol"`                     // Stock ticker.
+	Name      string  `json:"shortName"`                  // Company name.
 	LastTrade float64 `json:"regularMarketPrice"`         // l1: last trade.
 	Change    float64 `json:"regularMarketChange"`        // c6: change real time.
 	ChangePct float64 `json:"regularMarketChangePercent"` // k2: percent change real time.
 	Open      float64 `json:"regularMarketOpen"`          // o: market open price.
 	Low       float64 `json:"regularMarketDayLow"`        // g: day's low.
 	High      float64 `json:"regularMarketDayHigh"`       // h: day's high.
-	// Low52      float64 `json:"fiftyTwoWeekLow"`             // j: 52-weeks low.
-	// High52     float64 `json:"fiftyTwoWeekHigh"`            // k: 52-weeks high.
-	Volume    float64 `json:"regularMarketVolume"`     // v: volume.
-	AvgVolume float64 `json:"averageDailyVolume10Day"` // a2: average volume.
-	PeRatio   float64 `json:"trailingPE"`              // r2: P/E ration real time.
+	Volume    float64 `json:"regularMarketVolume"`        // v: volume.
+	AvgVolume float64 `json:"averageDailyVolume10Day"`    // a2: average volume.
+	PeRatio   float64 `json:"trailingPE"`                 // r2: P/E ration real time.
 	// PeRatioX   float64 `json:"trailingPE"`                  // r: P/E ration (fallback when real time is N/A).
 	Dividend float64 `json:"trailingAnnualDividendYield"` // d: dividend.
 	// Yield      float64 `json:"trailingAnnualDividendYield"` // y: dividend yield.
@@ -54,12 +80,15 @@ type Quote struct {
 	Earnings   json.Number `json:"earningsTimestamp"`
 	PreOpen    float64     `json:"preMarketChangePercent,omitempty"`
 	AfterHours float64     `json:"postMarketChangePercent,omitempty"`
-}
 
-func FetchMarket() (*[]Quote, error) {
-	return FetchQuotes(marketTickers)
+	// fields below have no column in the layout
+	Low52  float64 `json:"fiftyTwoWeekLow"`  // j: 52-weeks low.
+	High52 float64 `json:"fiftyTwoWeekHigh"` // k: 52-weeks high.
 }
 
+// fetchQuotes fetches the quotes, replaced in the tests
+var fetchQuotes = FetchQuotes
+
 // retrieve quotes for all tickers
 func FetchQuotes(tickers []string) (*[]Quote, error) {
 	result := []Quote{}
@@ -89,6 +118,156 @@ func FetchQuotes(tickers []string) (*[]Quote, error) {
 	return &result, nil
 }
 
+// Candle is one bar of a ticker's price history
+type Candle struct {
+	Time   time.Time
+	Open   float64
+	High   float64
+	Low    float64
+	Close  float64
+	Volume float64
+}
+
+// retrieve the price history of a ticker over rng, e.g. "1d" or "5y"
+func FetchHistory(ticker string, rng string) ([]Candle, error) {
+	interval, ok := historyIntervals[rng]
+	if !ok {
+		return nil, fmt.Errorf("unsupported range %s", rng)
+	}
+
+	url := fmt.Sprintf(apiURLChart, neturl.PathEscape(ticker), rng, interval)
+	response, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return unmarshalHistory(body)
+}
+
+// retrieve the price history of several tickers concurrently, tickers
+// that fail are left out of the result and the last error is returned
+func FetchHistories(tickers []string, rng string) (map[string][]Candle, error) {
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	var lastErr error
+	result := make(map[string][]Candle, len(tickers))
+	slots := make(chan bool, maxHistoryFetches)
+
+	for _, ticker := range tickers {
+		wg.Add(1)
+		go func(ticker string) {
+			defer wg.Done()
+			slots <- true
+			candles, err := FetchHistory(ticker, rng)
+			<-slots
+
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				lastErr = err
+				return
+			}
+			result[ticker] = candles
+		}(ticker)
+	}
+	wg.Wait()
+
+	return result, lastErr
+}
+
+func unmarshalHistory(body []byte) ([]Candle, error) {
+	var response struct {
+		Chart struct {
+			Result []struct {
+				Timestamp  []int64
+				Indicators struct {
+					Quote []struct {
+						Open   []*float64
+						High   []*float64
+						Low    []*float64
+						Close  []*float64
+						Volume []*float64
+					}
+				}
+			}
+			Error *struct {
+				Code        string
+				Description string
+			}
+		}
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	if response.Chart.Error != nil {
+		return nil, fmt.Errorf("%s", response.Chart.Error.Description)
+	}
+	if len(response.Chart.Result) == 0 ||
+		len(response.Chart.Result[0].Indicators.Quote) == 0 {
+		return []Candle{}, nil
+	}
+
+	result := response.Chart.Result[0]
+	bars := result.Indicators.Quote[0]
+	value := func(values []*float64, i int) float64 {
+		if i < len(values) && values[i] != nil {
+			return *values[i]
+		}
+		return 0
+	}
+
+	candles := make([]Candle, 0, len(result.Timestamp))
+	for i, ts := range result.Timestamp {
+		if i >= len(bars.Close) || bars.Close[i] == nil {
+			// no trades in this bar
+			continue
+		}
+		candles = append(candles, Candle{
+			Time:   time.Unix(ts, 0),
+			Open:   value(bars.Open, i),
+			High:   value(bars.High, i),
+			Low:    value(bars.Low, i),
+			Close:  value(bars.Close, i),
+			Volume: value(bars.Volume, i),
+		})
+	}
+	return candles, nil
+}
+
+// FetchSymbols returns the symbols the provider finds for query, best first
+func FetchSymbols(query string) ([]string, error) {
+	response, err := searchClient.Get(fmt.Sprintf(apiURLSearch, neturl.QueryEscape(query)))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var found struct {
+		Quotes []struct {
+			Symbol string `json:"symbol"`
+		} `json:"quotes"`
+	}
+	if err := json.Unmarshal(body, &found); err != nil {
+		return nil, err
+	}
+	symbols := []string{}
+	for _, q := range found.Quotes {
+		symbols = append(symbols, q.Symbol)
+	}
+	return symbols, nil
+}
+
 // retrieve quote for a single ticker
 func FetchWithTicker(ticker string) (Quote, error) {
 	result := Quote{}